@@ -0,0 +1,536 @@
+// Package config reads the rtldavis configuration file.  Every setting has
+// a command-line flag of the same meaning; flags given on the command line
+// override the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxTransmitters is the number of transmitter IDs a console can tell apart.
+const MaxTransmitters = 8
+
+// Transmitter types.
+const (
+	TypeVue                 = "vue"
+	TypeVP2                 = "vp2"
+	TypeVP2Plus             = "vp2plus"
+	TypeAnemometer          = "anemometer"
+	TypeTemperature         = "temperature"
+	TypeTemperatureHumidity = "temperature_humidity"
+	TypeLeafSoil            = "leaf_soil"
+)
+
+// callsignPattern matches an APRS source callsign with an optional SSID.
+var callsignPattern = regexp.MustCompile(`^[A-Za-z0-9]{3,6}(-[0-9A-Za-z]{1,2})?$`)
+
+// didPattern matches a WeatherLink Live device ID.
+var didPattern = regexp.MustCompile(`^[0-9A-Fa-f]{12}$`)
+
+var transmitterTypes = []string{
+	TypeVue, TypeVP2, TypeVP2Plus, TypeAnemometer,
+	TypeTemperature, TypeTemperatureHumidity, TypeLeafSoil,
+}
+
+type Config struct {
+	Radio        Radio         `yaml:"radio"`
+	Transmitters []Transmitter `yaml:"transmitters"`
+	Decoder      Decoder       `yaml:"decoder"`
+	Outputs      Outputs       `yaml:"outputs"`
+}
+
+type Radio struct {
+	Frequencies    string `yaml:"tf"`     // EU, US or NZ
+	PPM            int    `yaml:"ppm"`    // dongle crystal error
+	Gain           int    `yaml:"gain"`   // tenths of a dB, 0 = automatic
+	FreqCorrection int    `yaml:"fc"`     // Hz, added to every channel
+	Device         string `yaml:"device"` // serial number or index
+	RTLTCP         string `yaml:"rtltcp"` // host:port, instead of Device
+	DisableAFC     bool   `yaml:"noafc"`
+}
+
+// Transmitter is a station to listen for.  ID is the ID in the packets,
+// one less than the channel set with the DIP switches.
+type Transmitter struct {
+	ID   int    `yaml:"id"`
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+type Decoder struct {
+	MaxMissed int  `yaml:"maxmissed"` // packets missed in a row before resynchronizing
+	Extra     int  `yaml:"ex"`        // ms added to every loop period
+	Repair    int  `yaml:"repair"`    // flipped bits to repair, 0-2
+	Undefined bool `yaml:"undefined"` // log packets of other transmitters
+	Verbose   bool `yaml:"verbose"`
+}
+
+type Outputs struct {
+	HTTP         *HTTPOutput         `yaml:"http"`
+	MQTT         *MQTTOutput         `yaml:"mqtt"`
+	Influx       *InfluxOutput       `yaml:"influx"`
+	Metrics      *MetricsOutput      `yaml:"metrics"`
+	Graphite     *GraphiteOutput     `yaml:"graphite"`
+	Wunderground *WundergroundOutput `yaml:"wunderground"`
+	APRS         *APRSOutput         `yaml:"aprs"`
+	Vantage      *VantageOutput      `yaml:"vantage"`
+	WeatherLink  *WeatherLinkOutput  `yaml:"weatherlink"`
+	Record       string              `yaml:"record"` // .cu8 file to record to
+}
+
+// HTTPOutput POSTs the weather data as JSON.
+type HTTPOutput struct {
+	URL      string        `yaml:"url"`
+	APIKey   string        `yaml:"api_key"`
+	Interval time.Duration `yaml:"interval"`
+	Spool    *Spool        `yaml:"spool"`
+}
+
+// MQTTOutput publishes every reading to Prefix/<transmitter ID>/<field>.
+type MQTTOutput struct {
+	Broker   string        `yaml:"broker"` // host:port
+	ClientID string        `yaml:"client_id"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Prefix   string        `yaml:"prefix"`
+	QoS      int           `yaml:"qos"`
+	Retain   bool          `yaml:"retain"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Announce the transmitters to Home Assistant under DiscoveryPrefix.
+	HomeAssistant   bool   `yaml:"home_assistant"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+}
+
+// InfluxOutput writes InfluxDB line protocol, either to the HTTP write URL
+// or to a UDP listener.
+type InfluxOutput struct {
+	URL      string        `yaml:"url"` // e.g. http://localhost:8086/api/v2/write?org=home&bucket=weather
+	Token    string        `yaml:"token"`
+	UDP      string        `yaml:"udp"` // host:port, instead of URL
+	Interval time.Duration `yaml:"interval"`
+}
+
+// MetricsOutput serves the readings and the receiver's counters to
+// Prometheus.
+type MetricsOutput struct {
+	Listen string `yaml:"listen"` // host:port for the HTTP server, e.g. :9753
+}
+
+// GraphiteOutput writes the Graphite plaintext protocol to a carbon
+// listener, or to standard output if Addr is "-".
+type GraphiteOutput struct {
+	Addr     string            `yaml:"addr"` // host:port or -
+	Prefix   string            `yaml:"prefix"`
+	Names    map[string]string `yaml:"names"` // metric name by field; "" leaves the field out
+	Interval time.Duration     `yaml:"interval"`
+}
+
+// DefaultGraphite returns the Graphite settings for addr.
+func DefaultGraphite(addr string) *GraphiteOutput {
+	return &GraphiteOutput{Addr: addr, Prefix: "wx.davis", Interval: 10 * time.Second}
+}
+
+// WundergroundOutput uploads to Weather Underground as a personal weather
+// station.
+type WundergroundOutput struct {
+	StationID string        `yaml:"station_id"`
+	Key       string        `yaml:"key"`
+	URL       string        `yaml:"url"` // only to use another server with the same protocol
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// APRSOutput submits APRS weather reports to an APRS-IS server, such as
+// the Citizen Weather Observer Program's.
+type APRSOutput struct {
+	Server    string        `yaml:"server"`   // host:port
+	Callsign  string        `yaml:"callsign"` // e.g. CW1234 or a ham callsign with SSID
+	Passcode  *int          `yaml:"passcode"` // -1 for CWOP stations without a ham license
+	Latitude  *float64      `yaml:"latitude"` // decimal degrees; without a position the reports are positionless
+	Longitude *float64      `yaml:"longitude"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// VantageOutput emulates a Vantage console, streaming LOOP packets to
+// software that connects.
+type VantageOutput struct {
+	Listen string `yaml:"listen"` // host:port, e.g. :22222
+}
+
+// WeatherLinkOutput emulates the local API of a WeatherLink Live.
+type WeatherLinkOutput struct {
+	Listen    string `yaml:"listen"`    // host:port for the HTTP API; a WeatherLink Live uses :80
+	DID       string `yaml:"did"`       // device ID, twelve hex digits
+	Broadcast string `yaml:"broadcast"` // where real time UDP packets go
+}
+
+// Spool keeps data that could not be delivered on disk and retries it.
+type Spool struct {
+	Dir        string        `yaml:"dir"`
+	MaxMB      int           `yaml:"max_mb"`      // oldest data is dropped beyond this
+	MaxBackoff time.Duration `yaml:"max_backoff"` // longest wait between retries
+}
+
+// DefaultSpool returns the spool settings for dir.
+func DefaultSpool(dir string) *Spool {
+	return &Spool{Dir: dir, MaxMB: 100, MaxBackoff: 10 * time.Minute}
+}
+
+// Default returns the settings used when neither the file nor a flag says
+// otherwise.
+func Default() Config {
+	return Config{
+		Radio: Radio{
+			Frequencies: "US",
+			Device:      "0",
+		},
+		Transmitters: []Transmitter{{ID: 0, Type: TypeVue}},
+		Decoder: Decoder{
+			MaxMissed: 51,
+		},
+	}
+}
+
+// Load reads the file at path on top of the defaults.  Unknown keys are
+// errors, so that typos don't go unnoticed.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if h := cfg.Outputs.HTTP; h != nil {
+		if h.Interval == 0 {
+			h.Interval = 5 * time.Second
+		}
+		if sp := h.Spool; sp != nil {
+			def := DefaultSpool(sp.Dir)
+			if sp.MaxMB == 0 {
+				sp.MaxMB = def.MaxMB
+			}
+			if sp.MaxBackoff == 0 {
+				sp.MaxBackoff = def.MaxBackoff
+			}
+		}
+	}
+	if m := cfg.Outputs.MQTT; m != nil {
+		if m.ClientID == "" {
+			m.ClientID = "rtldavis"
+		}
+		if m.Prefix == "" {
+			m.Prefix = "rtldavis"
+		}
+		if m.Interval == 0 {
+			m.Interval = time.Second
+		}
+		if m.DiscoveryPrefix == "" {
+			m.DiscoveryPrefix = "homeassistant"
+		}
+	}
+	if i := cfg.Outputs.Influx; i != nil && i.Interval == 0 {
+		i.Interval = 10 * time.Second
+	}
+	if w := cfg.Outputs.Wunderground; w != nil && w.Interval == 0 {
+		w.Interval = time.Minute
+	}
+	if a := cfg.Outputs.APRS; a != nil {
+		if a.Server == "" {
+			a.Server = "cwop.aprs.net:14580"
+		}
+		if a.Passcode == nil {
+			unverified := -1
+			a.Passcode = &unverified
+		}
+		if a.Interval == 0 {
+			a.Interval = 5 * time.Minute
+		}
+	}
+	if w := cfg.Outputs.WeatherLink; w != nil {
+		if w.DID == "" {
+			w.DID = "001D0A000001"
+		}
+		if w.Broadcast == "" {
+			w.Broadcast = "255.255.255.255:22222"
+		}
+	}
+	if g := cfg.Outputs.Graphite; g != nil {
+		def := DefaultGraphite(g.Addr)
+		if g.Prefix == "" {
+			g.Prefix = def.Prefix
+		}
+		if g.Interval == 0 {
+			g.Interval = def.Interval
+		}
+	}
+	return cfg, nil
+}
+
+// Validate checks every setting and returns all problems found.
+func (cfg Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{field}, args...)...))
+	}
+
+	switch cfg.Radio.Frequencies {
+	case "EU", "US", "NZ":
+	default:
+		fail("radio.tf", "must be EU, US or NZ, not %q", cfg.Radio.Frequencies)
+	}
+	if cfg.Radio.Gain < 0 {
+		fail("radio.gain", "must be 0 (automatic) or a positive gain in tenths of a dB, not %d", cfg.Radio.Gain)
+	}
+
+	if len(cfg.Transmitters) == 0 {
+		fail("transmitters", "at least one transmitter is required")
+	}
+	seen := make(map[int]bool)
+	for i, t := range cfg.Transmitters {
+		field := fmt.Sprintf("transmitters[%d]", i)
+		if t.ID < 0 || t.ID >= MaxTransmitters {
+			fail(field+".id", "must be 0-%d (channel 1-%d), not %d", MaxTransmitters-1, MaxTransmitters, t.ID)
+		} else if seen[t.ID] {
+			fail(field+".id", "ID %d is listed twice", t.ID)
+		}
+		seen[t.ID] = true
+		if !slices.Contains(transmitterTypes, t.Type) {
+			fail(field+".type", "must be one of %v, not %q", transmitterTypes, t.Type)
+		}
+	}
+
+	if cfg.Decoder.MaxMissed < 1 {
+		fail("decoder.maxmissed", "must be at least 1, not %d", cfg.Decoder.MaxMissed)
+	}
+	if cfg.Decoder.Extra < 0 {
+		fail("decoder.ex", "must not be negative, not %d", cfg.Decoder.Extra)
+	}
+	if cfg.Decoder.Repair < 0 || cfg.Decoder.Repair > 2 {
+		fail("decoder.repair", "must be 0, 1 or 2, not %d", cfg.Decoder.Repair)
+	}
+
+	if h := cfg.Outputs.HTTP; h != nil {
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("outputs.http.url", "must be an http or https URL, not %q", h.URL)
+		}
+		if h.Interval <= 0 {
+			fail("outputs.http.interval", "must be positive, not %s", h.Interval)
+		}
+		if sp := h.Spool; sp != nil {
+			if sp.Dir == "" {
+				fail("outputs.http.spool.dir", "is required")
+			}
+			if sp.MaxMB <= 0 {
+				fail("outputs.http.spool.max_mb", "must be positive, not %d", sp.MaxMB)
+			}
+			if sp.MaxBackoff <= 0 {
+				fail("outputs.http.spool.max_backoff", "must be positive, not %s", sp.MaxBackoff)
+			}
+		}
+	}
+
+	if m := cfg.Outputs.MQTT; m != nil {
+		if _, _, err := net.SplitHostPort(m.Broker); err != nil {
+			fail("outputs.mqtt.broker", "must be host:port, not %q", m.Broker)
+		}
+		if m.Prefix == "" || strings.ContainsAny(m.Prefix, "+#") {
+			fail("outputs.mqtt.prefix", "must be a topic without wildcards, not %q", m.Prefix)
+		}
+		if m.QoS != 0 && m.QoS != 1 {
+			fail("outputs.mqtt.qos", "must be 0 or 1, not %d", m.QoS)
+		}
+		if m.Interval <= 0 {
+			fail("outputs.mqtt.interval", "must be positive, not %s", m.Interval)
+		}
+		if strings.ContainsAny(m.DiscoveryPrefix, "+#") {
+			fail("outputs.mqtt.discovery_prefix", "must be a topic without wildcards, not %q", m.DiscoveryPrefix)
+		}
+	}
+
+	if i := cfg.Outputs.Influx; i != nil {
+		switch {
+		case (i.URL == "") == (i.UDP == ""):
+			fail("outputs.influx", "needs either url or udp")
+		case i.URL != "":
+			if u, err := url.Parse(i.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("outputs.influx.url", "must be an http or https URL, not %q", i.URL)
+			}
+		default:
+			if _, _, err := net.SplitHostPort(i.UDP); err != nil {
+				fail("outputs.influx.udp", "must be host:port, not %q", i.UDP)
+			}
+		}
+		if i.Interval <= 0 {
+			fail("outputs.influx.interval", "must be positive, not %s", i.Interval)
+		}
+	}
+	if g := cfg.Outputs.Graphite; g != nil {
+		if _, _, err := net.SplitHostPort(g.Addr); err != nil && g.Addr != "-" {
+			fail("outputs.graphite.addr", "must be host:port or -, not %q", g.Addr)
+		}
+		fields := Transmitter{Type: TypeVP2Plus}.Sensors()
+		for field := range g.Names {
+			if !slices.Contains(fields, field) {
+				fail("outputs.graphite.names", "unknown field %q, must be one of %s", field, strings.Join(fields, ", "))
+			}
+		}
+		if g.Interval <= 0 {
+			fail("outputs.graphite.interval", "must be positive, not %s", g.Interval)
+		}
+	}
+	if w := cfg.Outputs.Wunderground; w != nil {
+		if w.StationID == "" {
+			fail("outputs.wunderground.station_id", "is required")
+		}
+		if w.Key == "" {
+			fail("outputs.wunderground.key", "is required")
+		}
+		if w.URL != "" {
+			if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("outputs.wunderground.url", "must be an http or https URL, not %q", w.URL)
+			}
+		}
+		if w.Interval <= 0 {
+			fail("outputs.wunderground.interval", "must be positive, not %s", w.Interval)
+		}
+	}
+	if a := cfg.Outputs.APRS; a != nil {
+		if _, _, err := net.SplitHostPort(a.Server); err != nil {
+			fail("outputs.aprs.server", "must be host:port, not %q", a.Server)
+		}
+		if !callsignPattern.MatchString(a.Callsign) {
+			fail("outputs.aprs.callsign", "must be a callsign like CW1234 or N0CALL-13, not %q", a.Callsign)
+		}
+		if (a.Latitude == nil) != (a.Longitude == nil) {
+			fail("outputs.aprs", "needs both latitude and longitude, or neither")
+		}
+		if a.Latitude != nil && (*a.Latitude < -90 || *a.Latitude > 90) {
+			fail("outputs.aprs.latitude", "must be -90 to 90, not %g", *a.Latitude)
+		}
+		if a.Longitude != nil && (*a.Longitude < -180 || *a.Longitude > 180) {
+			fail("outputs.aprs.longitude", "must be -180 to 180, not %g", *a.Longitude)
+		}
+		if a.Interval <= 0 {
+			fail("outputs.aprs.interval", "must be positive, not %s", a.Interval)
+		}
+	}
+	if v := cfg.Outputs.Vantage; v != nil {
+		if _, _, err := net.SplitHostPort(v.Listen); err != nil {
+			fail("outputs.vantage.listen", "must be host:port, not %q", v.Listen)
+		}
+	}
+	if w := cfg.Outputs.WeatherLink; w != nil {
+		if _, _, err := net.SplitHostPort(w.Listen); err != nil {
+			fail("outputs.weatherlink.listen", "must be host:port, not %q", w.Listen)
+		}
+		if !didPattern.MatchString(w.DID) {
+			fail("outputs.weatherlink.did", "must be twelve hex digits, not %q", w.DID)
+		}
+		if _, _, err := net.SplitHostPort(w.Broadcast); err != nil {
+			fail("outputs.weatherlink.broadcast", "must be host:port, not %q", w.Broadcast)
+		}
+	}
+	if m := cfg.Outputs.Metrics; m != nil {
+		if _, _, err := net.SplitHostPort(m.Listen); err != nil {
+			fail("outputs.metrics.listen", "must be host:port, not %q", m.Listen)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TransmitterMask returns the transmitters as the bitmask of the -tr flag.
+func (cfg Config) TransmitterMask() (mask int) {
+	for _, t := range cfg.Transmitters {
+		mask |= 1 << t.ID
+	}
+	return mask
+}
+
+// SetTransmitterMask replaces the transmitters with those in mask, keeping
+// the names and types of those already configured.
+func (cfg *Config) SetTransmitterMask(mask int) {
+	known := make(map[int]Transmitter)
+	for _, t := range cfg.Transmitters {
+		known[t.ID] = t
+	}
+	cfg.Transmitters = nil
+	for id := 0; id < MaxTransmitters; id++ {
+		if mask&(1<<id) == 0 {
+			continue
+		}
+		t, ok := known[id]
+		if !ok {
+			t = Transmitter{ID: id, Type: TypeVue}
+		}
+		cfg.Transmitters = append(cfg.Transmitters, t)
+	}
+}
+
+// Sensors returns the readings a transmitter of this type sends, named as
+// the MQTT topics.
+func (t Transmitter) Sensors() []string {
+	signal := []string{"battery_low", "rssi", "snr"}
+	iss := []string{"temperature", "humidity", "wind_speed", "wind_direction",
+		"gust_speed", "rain_rate", "rain_clicks", "supercap", "solar_voltage"}
+	switch t.Type {
+	case TypeVue, TypeVP2:
+		return append(iss, signal...)
+	case TypeVP2Plus:
+		return append(append(iss, "uv_index", "solar_radiation"), signal...)
+	case TypeAnemometer:
+		return append([]string{"wind_speed", "wind_direction"}, signal...)
+	case TypeTemperature:
+		return append([]string{"temperature"}, signal...)
+	case TypeTemperatureHumidity:
+		return append([]string{"temperature", "humidity"}, signal...)
+	}
+	return signal
+}
+
+// Model returns the product name of the transmitter type.
+func (t Transmitter) Model() string {
+	switch t.Type {
+	case TypeVue:
+		return "Vantage Vue ISS"
+	case TypeVP2:
+		return "Vantage Pro2 ISS"
+	case TypeVP2Plus:
+		return "Vantage Pro2 Plus ISS"
+	case TypeAnemometer:
+		return "Anemometer Transmitter"
+	case TypeTemperature:
+		return "Wireless Temperature Station"
+	case TypeTemperatureHumidity:
+		return "Wireless Temperature/Humidity Station"
+	case TypeLeafSoil:
+		return "Wireless Leaf & Soil Moisture/Temperature Station"
+	}
+	return t.Type
+}
+
+// Transmitter returns the transmitter with the given ID, if configured.
+func (cfg Config) Transmitter(id int) (Transmitter, bool) {
+	for _, t := range cfg.Transmitters {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Transmitter{}, false
+}
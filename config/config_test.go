@@ -0,0 +1,194 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rtldavis.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	cfg := Default()
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, 1, cfg.TransmitterMask())
+}
+
+func TestLoadExample(t *testing.T) {
+	cfg, err := Load("../rtldavis.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "US", cfg.Radio.Frequencies)
+	assert.Equal(t, []Transmitter{{ID: 0, Name: "iss", Type: TypeVue}}, cfg.Transmitters)
+	require.NotNil(t, cfg.Outputs.HTTP)
+	assert.Equal(t, 5*time.Second, cfg.Outputs.HTTP.Interval)
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(write(t, `
+radio:
+  tf: EU
+  gain: 496
+transmitters:
+  - {id: 0, type: vp2plus}
+  - {id: 2, name: pool, type: temperature}
+outputs:
+  http:
+    url: http://localhost:3000/weather
+    spool:
+      dir: /var/lib/rtldavis
+      max_mb: 5
+`))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "EU", cfg.Radio.Frequencies)
+	assert.Equal(t, 496, cfg.Radio.Gain)
+	assert.Equal(t, "0", cfg.Radio.Device, "unset keys keep their defaults")
+	assert.Equal(t, 51, cfg.Decoder.MaxMissed)
+	assert.Equal(t, 5, cfg.TransmitterMask())
+	assert.Equal(t, 5*time.Second, cfg.Outputs.HTTP.Interval)
+	assert.Equal(t, &Spool{Dir: "/var/lib/rtldavis", MaxMB: 5, MaxBackoff: 10 * time.Minute}, cfg.Outputs.HTTP.Spool)
+
+	pool, ok := cfg.Transmitter(2)
+	assert.True(t, ok)
+	assert.Equal(t, "pool", pool.Name)
+	_, ok = cfg.Transmitter(1)
+	assert.False(t, ok)
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	_, err := Load(write(t, "radio:\n  frequencies: EU\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field frequencies not found")
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load(write(t, `
+radio:
+  tf: AU
+transmitters:
+  - {id: 8, type: vue}
+  - {id: 1, type: vue}
+  - {id: 1, type: weather}
+decoder:
+  maxmissed: 0
+  repair: 3
+outputs:
+  http:
+    url: localhost:3000
+  mqtt:
+    broker: localhost
+    prefix: davis/#
+    qos: 2
+  influx:
+    url: http://localhost:8086/write
+    udp: localhost:8089
+  metrics:
+    listen: "9753"
+  graphite:
+    addr: localhost
+    names:
+      temp: t
+  wunderground:
+    key: secret
+  aprs:
+    callsign: "CW 1234"
+    latitude: 91
+  vantage:
+    listen: localhost
+  weatherlink:
+    listen: :8080
+    did: 001D0A7
+`))
+	require.NoError(t, err)
+
+	err = cfg.Validate()
+	require.Error(t, err)
+	for _, msg := range []string{
+		`radio.tf: must be EU, US or NZ, not "AU"`,
+		"transmitters[0].id: must be 0-7 (channel 1-8), not 8",
+		"transmitters[2].id: ID 1 is listed twice",
+		`transmitters[2].type: must be one of`,
+		"decoder.maxmissed: must be at least 1, not 0",
+		"decoder.repair: must be 0, 1 or 2, not 3",
+		`outputs.http.url: must be an http or https URL, not "localhost:3000"`,
+		`outputs.mqtt.broker: must be host:port, not "localhost"`,
+		`outputs.mqtt.prefix: must be a topic without wildcards, not "davis/#"`,
+		"outputs.mqtt.qos: must be 0 or 1, not 2",
+		"outputs.influx: needs either url or udp",
+		`outputs.graphite.addr: must be host:port or -, not "localhost"`,
+		`outputs.graphite.names: unknown field "temp", must be one of temperature, humidity, wind_speed, wind_direction, gust_speed, rain_rate, rain_clicks, supercap, solar_voltage, uv_index, solar_radiation, battery_low, rssi, snr`,
+		"outputs.wunderground.station_id: is required",
+		`outputs.aprs.callsign: must be a callsign like CW1234 or N0CALL-13, not "CW 1234"`,
+		"outputs.aprs: needs both latitude and longitude, or neither",
+		"outputs.aprs.latitude: must be -90 to 90, not 91",
+		`outputs.vantage.listen: must be host:port, not "localhost"`,
+		`outputs.weatherlink.did: must be twelve hex digits, not "001D0A7"`,
+		`outputs.metrics.listen: must be host:port, not "9753"`,
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestSetTransmitterMask(t *testing.T) {
+	cfg := Default()
+	cfg.Transmitters = []Transmitter{{ID: 0, Name: "iss", Type: TypeVP2}, {ID: 3, Type: TypeVue}}
+
+	cfg.SetTransmitterMask(1 | 2)
+	assert.Equal(t, []Transmitter{{ID: 0, Name: "iss", Type: TypeVP2}, {ID: 1, Type: TypeVue}}, cfg.Transmitters)
+	assert.Equal(t, 3, cfg.TransmitterMask())
+}
+
+func TestMQTTDefaults(t *testing.T) {
+	cfg, err := Load(write(t, "outputs:\n  mqtt:\n    broker: localhost:1883\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, &MQTTOutput{
+		Broker:          "localhost:1883",
+		ClientID:        "rtldavis",
+		Prefix:          "rtldavis",
+		Interval:        time.Second,
+		DiscoveryPrefix: "homeassistant",
+	}, cfg.Outputs.MQTT)
+}
+
+func TestGraphiteDefaults(t *testing.T) {
+	cfg, err := Load(write(t, "outputs:\n  graphite:\n    addr: \"-\"\n    names: {humidity: \"\"}\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, &GraphiteOutput{
+		Addr:     "-",
+		Prefix:   "wx.davis",
+		Names:    map[string]string{"humidity": ""},
+		Interval: 10 * time.Second,
+	}, cfg.Outputs.Graphite)
+}
+
+func TestAPRSDefaults(t *testing.T) {
+	cfg, err := Load(write(t, "outputs:\n  aprs:\n    callsign: CW1234\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	a := cfg.Outputs.APRS
+	assert.Equal(t, "cwop.aprs.net:14580", a.Server)
+	require.NotNil(t, a.Passcode)
+	assert.Equal(t, -1, *a.Passcode)
+	assert.Nil(t, a.Latitude)
+	assert.Equal(t, 5*time.Minute, a.Interval)
+}
+
+func TestTransmitterSensors(t *testing.T) {
+	assert.Contains(t, Transmitter{Type: TypeVue}.Sensors(), "rain_rate")
+	assert.NotContains(t, Transmitter{Type: TypeVue}.Sensors(), "uv_index")
+	assert.Contains(t, Transmitter{Type: TypeVP2Plus}.Sensors(), "uv_index")
+	assert.Contains(t, Transmitter{Type: TypeVP2Plus}.Sensors(), "solar_radiation")
+	assert.Equal(t, []string{"temperature", "battery_low", "rssi", "snr"}, Transmitter{Type: TypeTemperature}.Sensors())
+	assert.Equal(t, "Vantage Pro2 Plus ISS", Transmitter{Type: TypeVP2Plus}.Model())
+}
@@ -0,0 +1,75 @@
+package crc
+
+// Corrector repairs messages with a few flipped bits.  The CRC is linear,
+// so the checksum of a damaged message, its syndrome, depends only on which
+// bits were flipped.  Corrector looks the syndrome up in a table of every
+// error pattern of up to MaxBits bits.
+type Corrector struct {
+	CRC     CRC
+	Length  int // message length in bytes, checksum included
+	MaxBits int
+
+	// Bit positions by syndrome.  Syndromes shared by two patterns map to
+	// nil, those messages can't be repaired.
+	syndromes map[uint16][]int
+}
+
+func NewCorrector(crc CRC, length, maxBits int) *Corrector {
+	c := &Corrector{
+		CRC:       crc,
+		Length:    length,
+		MaxBits:   maxBits,
+		syndromes: make(map[uint16][]int),
+	}
+
+	bits := length * 8
+	pattern := make([]byte, length)
+	add := func(positions ...int) {
+		for i := range pattern {
+			pattern[i] = 0
+		}
+		for _, pos := range positions {
+			pattern[pos>>3] ^= 0x80 >> (pos & 7)
+		}
+		// Init cancels out between the good and the damaged message.
+		s := Checksum(0, pattern, crc.tbl)
+		if _, taken := c.syndromes[s]; taken {
+			c.syndromes[s] = nil
+			return
+		}
+		c.syndromes[s] = positions
+	}
+	if maxBits >= 1 {
+		for i := 0; i < bits; i++ {
+			add(i)
+		}
+	}
+	if maxBits >= 2 {
+		for i := 0; i < bits; i++ {
+			for j := i + 1; j < bits; j++ {
+				add(i, j)
+			}
+		}
+	}
+	return c
+}
+
+// Correct repairs data in place and returns how many bits it flipped.  It
+// returns false if data is damaged beyond repair; data is left untouched.
+func (c *Corrector) Correct(data []byte) (int, bool) {
+	if len(data) != c.Length {
+		return 0, false
+	}
+	s := c.CRC.Checksum(data) ^ c.CRC.Residue
+	if s == 0 {
+		return 0, true
+	}
+	positions := c.syndromes[s]
+	if positions == nil {
+		return 0, false
+	}
+	for _, pos := range positions {
+		data[pos>>3] ^= 0x80 >> (pos & 7)
+	}
+	return len(positions), true
+}
@@ -76,3 +76,58 @@ func BenchmarkCCITT(b *testing.B) {
 		ccitt.Checksum(input)
 	}
 }
+
+func TestCorrector(t *testing.T) {
+	ccitt := NewCRC("CCITT-16", 0, 0x1021, 0)
+	msg := []byte{0x80, 0x00, 0x00, 0x33, 0x8D, 0x00, 0x25, 0x11}
+	one := NewCorrector(ccitt, len(msg), 1)
+	two := NewCorrector(ccitt, len(msg), 2)
+
+	buf := make([]byte, len(msg))
+	flip := func(bits ...int) {
+		copy(buf, msg)
+		for _, bit := range bits {
+			buf[bit>>3] ^= 0x80 >> (bit & 7)
+		}
+	}
+
+	flip()
+	if n, ok := one.Correct(buf); n != 0 || !ok {
+		t.Fatalf("intact message: %d %v", n, ok)
+	}
+
+	for i := 0; i < len(msg)*8; i++ {
+		flip(i)
+		if n, ok := one.Correct(buf); n != 1 || !ok || string(buf) != string(msg) {
+			t.Fatalf("bit %d: %d %v %02X", i, n, ok, buf)
+		}
+	}
+
+	repaired, ambiguous := 0, 0
+	for i := 0; i < len(msg)*8; i++ {
+		for j := i + 1; j < len(msg)*8; j++ {
+			flip(i, j)
+			if _, ok := one.Correct(buf); ok {
+				t.Fatalf("bits %d and %d repaired with one bit", i, j)
+			}
+			n, ok := two.Correct(buf)
+			if !ok {
+				ambiguous++
+				continue
+			}
+			if n != 2 || string(buf) != string(msg) {
+				t.Fatalf("bits %d and %d: %d %02X", i, j, n, buf)
+			}
+			repaired++
+		}
+	}
+	t.Logf("two bits: %d repaired, %d ambiguous", repaired, ambiguous)
+	if repaired < ambiguous {
+		t.Fatalf("most two-bit errors should be repairable")
+	}
+
+	buf = append(buf, 0)
+	if _, ok := two.Correct(buf); ok {
+		t.Fatalf("wrong length accepted")
+	}
+}
@@ -96,6 +96,20 @@ func Discriminate(in []complex128, out []float64) {
 	}
 }
 
+// MagnitudeSquared stores the power of each of the samples following in[0],
+// so that out lines up with the output of Discriminate.
+func MagnitudeSquared(in []complex128, out []float64) {
+	for idx := range out {
+		n := in[idx+1]
+		out[idx] = real(n)*real(n) + imag(n)*imag(n)
+	}
+}
+
+// Decibels converts a power relative to full scale to dBFS.
+func Decibels(power float64) float64 {
+	return 10 * math.Log10(math.Max(power, 1e-12))
+}
+
 func Quantize(input []float64, output []byte) {
 	for idx, val := range input {
 		output[idx] = byte(math.Float64bits(val) >> 63)
@@ -131,6 +145,10 @@ func (d *Demodulator) Search() (indexes []int) {
 type Packet struct {
 	Idx  int
 	Data []byte
+
+	// Power over the packet and noise floor in dBFS, and their difference
+	// in dB.
+	RSSI, Noise, SNR float64
 }
 
 func (d *Demodulator) Slice(indices []int) (pkts []Packet) {
@@ -157,8 +175,11 @@ func (d *Demodulator) Slice(indices []int) (pkts []Packet) {
 		if !seen[pktStr] {
 			seen[pktStr] = true
 
-			pkt := Packet{qIdx, make([]byte, len(d.pkt))}
+			pkt := Packet{Idx: qIdx, Data: make([]byte, len(d.pkt))}
 			copy(pkt.Data, d.pkt)
+			pkt.RSSI = Decibels(d.signalPower(qIdx))
+			pkt.Noise = Decibels(d.noiseFloor())
+			pkt.SNR = pkt.RSSI - pkt.Noise
 			pkts = append(pkts, pkt)
 		}
 	}
@@ -166,6 +187,30 @@ func (d *Demodulator) Slice(indices []int) (pkts []Packet) {
 	return
 }
 
+// signalPower returns the mean power of the packet starting at qIdx.
+func (d *Demodulator) signalPower(qIdx int) float64 {
+	end := min(qIdx+d.Cfg.PacketLength, len(d.Power))
+	var sum float64
+	for _, p := range d.Power[qIdx:end] {
+		sum += p
+	}
+	return sum / float64(end-qIdx)
+}
+
+// noiseFloor returns the power of the quietest recent block.
+func (d *Demodulator) noiseFloor() float64 {
+	floor := math.Inf(1)
+	for _, p := range d.blockPower {
+		if p > 0 && p < floor {
+			floor = p
+		}
+	}
+	if math.IsInf(floor, 1) {
+		return 0
+	}
+	return floor
+}
+
 // PacketConfig specifies packet-specific radio configuration.
 type PacketConfig struct {
 	BitRate                        int
@@ -229,6 +274,10 @@ func (cfg PacketConfig) Log() {
 	log.Println("BufferLength:", cfg.BufferLength)
 }
 
+// NoiseBlocks is how many blocks the noise floor is taken over, a little
+// more than a tenth of a second.
+const NoiseBlocks = 64
+
 type Demodulator struct {
 	Cfg *PacketConfig
 
@@ -237,6 +286,11 @@ type Demodulator struct {
 	Filtered      []complex128
 	Discriminated []float64
 	Quantized     []byte
+	Power         []float64
+
+	// Mean power of the last NoiseBlocks blocks, for the noise floor.
+	blockPower    []float64
+	blockPowerIdx int
 
 	slices [][]byte
 	pkt    []byte
@@ -250,8 +304,12 @@ func NewDemodulator(cfg *PacketConfig) (d Demodulator) {
 	d.Raw = make([]byte, d.Cfg.BufferLength<<1)
 	d.IQ = make([]complex128, d.Cfg.BlockSize+9)
 	d.Filtered = make([]complex128, d.Cfg.BlockSize+1)
-	d.Discriminated = make([]float64, d.Cfg.BlockSize*2)
+	// Discriminated is as long as Quantized so that packet indexes into
+	// one are valid in the other.
+	d.Discriminated = make([]float64, d.Cfg.BufferLength)
 	d.Quantized = make([]byte, d.Cfg.BufferLength)
+	d.Power = make([]float64, d.Cfg.BufferLength)
+	d.blockPower = make([]float64, NoiseBlocks)
 
 	d.slices = make([][]byte, d.Cfg.SymbolLength)
 	flat := make([]byte, d.Cfg.BufferLength-(d.Cfg.BufferLength%d.Cfg.SymbolLength))
@@ -278,18 +336,31 @@ func (d *Demodulator) Demodulate(input []byte) []Packet {
 	d.Filtered[0] = d.Filtered[len(d.Filtered)-1]
 	copy(d.Discriminated, d.Discriminated[d.Cfg.BlockSize:])
 	copy(d.Quantized, d.Quantized[d.Cfg.BlockSize:])
+	copy(d.Power, d.Power[d.Cfg.BlockSize:])
 
 	copy(d.Raw[d.Cfg.BufferLength<<1-d.Cfg.BlockSize2:], input)
 
 	d.lut.Execute(d.Raw[d.Cfg.BufferLength<<1-d.Cfg.BlockSize2:], d.IQ[9:])
 	RotateFs4(d.IQ[9:], d.IQ[9:])
 	FIR9(d.IQ, d.Filtered[1:])
-	Discriminate(d.Filtered, d.Discriminated[d.Cfg.BlockSize:])
-	Quantize(d.Discriminated[d.Cfg.BlockSize:], d.Quantized[d.Cfg.BufferLength-d.Cfg.BlockSize:])
+	Discriminate(d.Filtered, d.Discriminated[d.Cfg.BufferLength-d.Cfg.BlockSize:])
+	Quantize(d.Discriminated[d.Cfg.BufferLength-d.Cfg.BlockSize:], d.Quantized[d.Cfg.BufferLength-d.Cfg.BlockSize:])
+	d.measure(d.Power[d.Cfg.BufferLength-d.Cfg.BlockSize:])
 	d.Pack(d.Quantized)
 	return d.Slice(d.Search())
 }
 
+// measure stores the power of the new block and its mean for the noise floor.
+func (d *Demodulator) measure(power []float64) {
+	MagnitudeSquared(d.Filtered, power)
+	var sum float64
+	for _, p := range power {
+		sum += p
+	}
+	d.blockPower[d.blockPowerIdx] = sum / float64(len(power))
+	d.blockPowerIdx = (d.blockPowerIdx + 1) % len(d.blockPower)
+}
+
 func (d *Demodulator) Reset() {
 	for idx := range d.Raw {
 		d.Raw[idx] = 0
@@ -306,4 +377,10 @@ func (d *Demodulator) Reset() {
 	for idx := range d.Quantized {
 		d.Quantized[idx] = 0
 	}
+	for idx := range d.Power {
+		d.Power[idx] = 0
+	}
+	for idx := range d.blockPower {
+		d.blockPower[idx] = 0
+	}
 }
@@ -34,7 +34,6 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"io"
 	"log"
 	"os"
@@ -44,76 +43,45 @@ import (
 
 	"log/slog"
 
-	rtlsdr "github.com/jpoirier/gortlsdr"
-	"github.com/nathanmsmith/rtldavis/processor"
+	"github.com/nathanmsmith/rtldavis/config"
+	"github.com/nathanmsmith/rtldavis/metrics"
 	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/recording"
+	"github.com/nathanmsmith/rtldavis/scheduler"
+	"github.com/nathanmsmith/rtldavis/source"
 )
 
-// nms: max transmitter?
-const maxTr = 8
-
 var (
 	// program settings
+	tr              int     // -tr = transmitters to listen for
 	ex              int     // -ex = extra loopTime in msex
 	fc              int     // -fc = frequency correction for all channels
 	ppm             int     // -ppm = frequency correction of rtl dongle in ppm
 	gain            int     // -gain = tuner gain in tenths of a Db
 	maxmissed       int     // -maxmisssed = max missed-packets-in-a-row before new init
+	repair          int     // -repair = max flipped bits to repair per packet
 	transmitterFreq *string // -tf = transmitter frequencies, EU, US or NZ.
 	undefined       *bool   // -u = log undefined signals
 	verbose         *bool   // -v = emit verbose debug messages
 	disableAfc      *bool   // -noafc = disable any automatic corrections
 	deviceString    *string // -d = device serial number or device index
+	rtltcpAddr      *string // -rtltcp = read samples from an rtl_tcp server instead of a local device
 	serverSrv       *string // -gs = decode the packets and send to server
 	apiKey          *string // -ak = api key for sending data to server
+	spoolDir        *string // -spool = keep undelivered data for the server in this directory
+	recordPath      *string // -record = write raw IQ and a hop/message log to this file
+	replayPath      *string // -replay = decode a recording instead of listening
+	configPath      *string // -config = YAML file with the settings; flags override it
+
+	cfg config.Config // the settings after merging the config file and the flags
 	// general
-	actChan [maxTr]int // list with actual channels (0-7);
-	// nms: not sure what this comment means
-	//   next values are zero (non-meaning)
-	msgIdToChan []int // msgIdToChan[id] is pointer to channel in actChan;
-	//   non-defined id's have ptr value 9
-	expectedChanPtr int   // pointer to actChan of next expected msg.Data
-	curTime         int64 // current UTC-nanoseconds
-	maxFreq         int   // number of frequencies (EU=5, US=51)
-	maxChan         int   // number of defined (=actual) channels
-	receiveWindow   int   // timespan in ms for receiving a message
-
-	// per channel (index is actChan[ch])
-	chLastVisits  [maxTr]int64   // last visit times in UTC-nanoseconds
-	chNextVisits  [maxTr]int64   // next visit times (future) in UTC-nanoseconds
-	chTotMsgs     [maxTr]int     // total received messages since startup
-	chAlarmCnts   [maxTr]int     // numbers of missed-counts-in-a-row
-	chLastHops    [maxTr]int     // last hop channel-ids (sequential order)
-	chNextHops    [maxTr]int     // next hop channel-ids (sequential order)
-	chMissPerFreq [maxTr][51]int // transmitter missed per frequency channel
-
-	// per id (index is msg.ID)
-	idLoopPeriods [maxTr]time.Duration // durations of one loop (higher IDs: longer durations)
-	idUndefs      [maxTr]int           // number of received messages of undefined id's since startup
-
-	// totals
-	totInit int // total of init procedures since startup (first not counted)
+	receiveWindow int // timespan in ms for receiving a message
 
 	// hop and channel-frequency
-	// This field was originally in code, but unused
-	// loopTimer      time.Time     // time when next hop sequence will time-out
-	loopPeriod     time.Duration // period since now when next hop sequence will time-out
-	actHopChanIdx  int           // channel-id of actual hop sequence (EU: 0-4, US and NZ: 0-50)
-	nextHopChan    int           // channel-id of next hop
-	nextHopTran    int           // transmitter-id of next hop
-	channelFreq    int           // frequency of the channel to transmit
-	freqCorr       int           // frequency error of last hop
-	freqCorrection int           // frequencyCorrection (average freqError per transmitter per channel)
-
-	// control
-	initTransmitrs  bool // start an init session to synchronize all defined channels
-	handleNxtPacket bool // start preparation for reading next data packet
-
-	// init
-	visitCount int // number of different active channels seen during init
-
-	// msg handling
-	lastRecMsg string // string of last received raw code
+	actHopChanIdx  int // channel-id of actual hop sequence (EU: 0-4, US and NZ: 0-50)
+	channelFreq    int // frequency of the channel to transmit
+	freqCorr       int // frequency error of last hop
+	freqCorrection int // frequencyCorrection (average freqError per transmitter per channel)
 
 	// test
 	testFreq        bool
@@ -126,12 +94,7 @@ var (
 
 func init() {
 	VERSION := "0.15.2nms"
-	var (
-		tr   int
-		mask int
-	)
-	msgIdToChan = []int{9, 9, 9, 9, 9, 9, 9, 9} // preset with 9 (= undefined)
-	receiveWindow = 300                         // in ms
+	receiveWindow = 300 // in ms
 
 	log.SetFlags(log.Lmicroseconds)
 
@@ -144,6 +107,7 @@ func init() {
 	// supported gain values: 0, 9, 14, 27, 37, 77, 87, 125, 144, 157, 166, 197, 207,
 	// 229, 254, 280, 297, 328, 338, 364, 372, 386, 402, 421, 434, 439, 445, 480, 496.
 	flag.IntVar(&maxmissed, "maxmissed", 51, "max missed-packets-in-a-row before new init")
+	flag.IntVar(&repair, "repair", 0, "repair packets with up to this many flipped bits (0-2)")
 	flag.IntVar(&startFreq, "startfreq", 0, "test")
 	flag.IntVar(&endFreq, "endfreq", 0, "test")
 	flag.IntVar(&stepFreq, "stepfreq", 0, "test")
@@ -152,31 +116,24 @@ func init() {
 	verbose = flag.Bool("v", false, "emit verbose debug messages")
 	disableAfc = flag.Bool("noafc", false, "disable any AFC")
 	deviceString = flag.String("d", "0", "device serial number or device index")
-	serverSrv = flag.String("gs", "", "decode packets and send to server server")
+	rtltcpAddr = flag.String("rtltcp", "", "host:port of an rtl_tcp server to use instead of a local device")
+	serverSrv = flag.String("gs", "", "decode packets and send to server server, or - to write them to stdout in the Graphite format")
 	apiKey = flag.String("ak", "", "api key for sending data to server")
+	spoolDir = flag.String("spool", "", "directory to keep data the server did not accept, to retry later")
+	recordPath = flag.String("record", "", "record raw IQ samples to this .cu8 file, with hops and messages in a .jsonl sidecar")
+	replayPath = flag.String("replay", "", "decode a recording made with -record instead of listening to the radio")
+	configPath = flag.String("config", "", "YAML config file; flags given on the command line override it")
 
 	flag.Parse()
+	cfg = loadConfig(*configPath)
 	protocol.Verbose = *verbose
 
 	log.Printf("rtldavis.go VERSION=%s", VERSION)
-	// convert tranceiver code to act channels
-	mask = 1
-	for i := range actChan {
-		if tr&mask != 0 {
-			actChan[maxChan] = i
-			msgIdToChan[i] = maxChan
-			maxChan += 1
-		}
-		mask = mask << 1
-	}
-	log.Printf("tr=%d fc=%d ppm=%d gain=%d maxmissed=%d ex=%d receiveWindow=%d actChan=%d maxChan=%d", tr, fc, ppm, gain, maxmissed, ex, receiveWindow, actChan[0:maxChan], maxChan)
-	log.Printf("undefined=%v verbose=%v disableAfc=%v deviceString=%s", *undefined, *verbose, *disableAfc, *deviceString)
-
-	// Preset loopperiods per id
-	idLoopPeriods[0] = 2562500 * time.Microsecond
-	for i := 1; i < 8; i++ {
-		idLoopPeriods[i] = idLoopPeriods[i-1] + 62500*time.Microsecond
+	log.Printf("tr=%d fc=%d ppm=%d gain=%d maxmissed=%d repair=%d ex=%d receiveWindow=%d", tr, fc, ppm, gain, maxmissed, repair, ex, receiveWindow)
+	for _, t := range cfg.Transmitters {
+		log.Printf("transmitter ID=%d name=%q type=%s", t.ID, t.Name, t.Type)
 	}
+	log.Printf("undefined=%v verbose=%v disableAfc=%v deviceString=%s rtltcp=%s record=%s", *undefined, *verbose, *disableAfc, *deviceString, *rtltcpAddr, *recordPath)
 
 	// check if test
 	if startFreq != 0 && endFreq != 0 && stepFreq != 0 {
@@ -188,95 +145,93 @@ func init() {
 }
 
 func main() {
-	// var sdrIndex int
+	if *replayPath != "" {
+		replay(*replayPath)
+		return
+	}
+
 	p := protocol.NewParser(14, *transmitterFreq)
+	p.SetRepair(repair)
 	p.Cfg.Log()
 
 	fs := p.Cfg.SampleRate
 
-	// nms: I don't think this code does anything! sdrIndex isn't used anywhere
-	// First attempt to open the device as a Serial Number
-	// sdrIndex, _ = rtlsdr.GetIndexBySerial(*deviceString)
-	// if sdrIndex < 0 {
-	// 	indexreturn, err := strconv.Atoi(*deviceString)
-	// 	if err != nil {
-	// 		log.Printf("Could not parse device\n")
-	// 		log.Fatal(err)
-	// 	}
-	// 	sdrIndex = indexreturn
-	// }
-
-	dev, err := rtlsdr.Open(0)
-	if err != nil {
-		slog.Error("Could not find antenna, is it plugged in?")
-		os.Exit(1)
+	var src source.SampleSource
+	var err error
+	if *rtltcpAddr != "" {
+		src, err = source.DialRTLTCP(*rtltcpAddr)
+		if err != nil {
+			slog.Error("Could not connect to rtl_tcp server", "address", *rtltcpAddr, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Connected to rtl_tcp server", "address", *rtltcpAddr)
+	} else {
+		src, err = openRtlsdr(*deviceString)
+		if err != nil {
+			slog.Error("Could not find antenna, is it plugged in?", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Found antenna")
 	}
-	slog.Info("Found antenna")
 
-	hop := p.SetHop(0, 0) // start program with first hop frequency
-	log.Printf("Hop: %s", hop)
-	if err := dev.SetCenterFreq(hop.ChannelFreq + fc); err != nil {
-		log.Fatal(err)
+	var rec *recording.Recorder
+	if *recordPath != "" {
+		rec, err = recording.Create(*recordPath, recording.Header{
+			SampleRate:      fs,
+			BlockSize:       p.Cfg.BlockSize2,
+			TransmitterFreq: *transmitterFreq,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Recording to %s and %s", *recordPath, recording.SidecarPath(*recordPath))
 	}
 
-	if err := dev.SetSampleRate(fs); err != nil {
+	sched := scheduler.New(scheduler.Config{
+		Transmitters:  tr,
+		ChannelCount:  p.ChannelCount,
+		MaxMissed:     maxmissed,
+		ReceiveWindow: time.Duration(receiveWindow) * time.Millisecond,
+		Extra:         time.Duration(ex) * time.Millisecond,
+	}, &p)
+	log.Printf("actChan=%d", sched.Transmitters())
+	// Time to wait for one full rotation of the pattern + 1 for the slowest transmitter.
+	ids := sched.Transmitters()
+	syncPeriod := time.Duration(p.ChannelCount+2) * scheduler.LoopPeriod(ids[len(ids)-1])
+
+	step := sched.Start(time.Now()) // start program with first hop frequency
+	hop := step.Hop
+	actHopChanIdx = hop.ChannelIdx
+	log.Printf("Hop: %s", hop)
+	if err := src.SetCenterFreq(hop.ChannelFreq + fc); err != nil {
 		log.Fatal(err)
 	}
+	if rec != nil {
+		if err := rec.Hop(hop, hop.ChannelFreq+fc, time.Now()); err != nil {
+			log.Printf("Error recording hop: %v", err)
+		}
+	}
 
-	// set SetTunerGainMode
-	ManualGainMode := gain != 0
-
-	if err := dev.SetTunerGainMode(ManualGainMode); err != nil {
+	if err := src.SetSampleRate(fs); err != nil {
 		log.Fatal(err)
 	}
 
-	if gain != 0 {
-		gains, err := dev.GetTunerGains()
-		if err != nil {
-			log.Printf("GetTunerGains Failed - error: %s\n", err)
-		} else if len(gains) > 0 {
-			gainInfo := "Supported tuner gain: "
-			for i := 0; i < len(gains); i++ {
-				gainInfo += fmt.Sprintf("%d Db ", int(gains[i]))
-			}
-			log.Printf("%s", gainInfo)
-		}
-		err = dev.SetTunerGain(gain)
-		if err != nil {
-			log.Printf("SetTunerGain %d gain Failed, error: %s\n", gain, err)
-		} else {
-			log.Printf("SetTunerGain %d Successful\n", gain)
-		}
+	if err := src.SetTunerGain(gain); err != nil {
+		log.Fatal(err)
 	}
 
-	tgain := dev.GetTunerGain()
-	log.Printf("GetTunerGain: %d Db\n", tgain)
-
-	err = dev.SetFreqCorrection(ppm)
+	err = src.SetFreqCorrection(ppm)
 	if err != nil {
 		log.Printf("SetFreqCorrection %d ppm Failed, error: %s\n", ppm, err)
 	} else {
 		log.Printf("SetFreqCorrection %d ppm Successful\n", ppm)
 	}
 
-	if err := dev.ResetBuffer(); err != nil {
+	if err := src.Start(p.Cfg.BlockSize2); err != nil {
 		log.Fatal(err)
 	}
 
-	in, out := io.Pipe()
-
-	go func() {
-		err := dev.ReadAsync(func(buf []byte) {
-			_, err := out.Write(buf)
-			if err != nil {
-				log.Printf("Error in writing buffer: %v\n", err)
-			}
-		}, nil, 1, p.Cfg.BlockSize2)
-		if err != nil {
-			log.Printf("Error in ReadAsync: %v\n", err)
-			return
-		}
-	}()
+	receiver := metrics.NewReceiver()
 
 	// Handle frequency hops concurrently since the callback will stall if we
 	// stop reading to hop.
@@ -298,7 +253,6 @@ func main() {
 			} else {
 				freqCorrection = freqCorr
 				log.Printf("Hop: %s", hop)
-				actHopChanIdx = hop.ChannelIdx
 				channelFreq = hop.ChannelFreq
 			}
 			if *disableAfc {
@@ -307,24 +261,36 @@ func main() {
 			if *verbose {
 				log.Printf("applied freqCorrection=%d", freqCorrection)
 			}
+			receiver.SetFreqCorrection(hop, freqCorrection)
 
-			if err := dev.SetCenterFreq(channelFreq + freqCorrection + fc); err != nil {
+			if err := src.SetCenterFreq(channelFreq + freqCorrection + fc); err != nil {
 				//log.Fatal(err)  // no reason top stop program for one error
 				log.Printf("SetCenterFreq: %d error: %s", hop.ChannelFreq, err)
 			}
+			if rec != nil {
+				if err := rec.Hop(hop, channelFreq+freqCorrection+fc, time.Now()); err != nil {
+					log.Printf("Error recording hop: %v", err)
+				}
+			}
 		}
 	}()
 
-	processor := processor.NewWeatherProcessor(
-		*serverSrv,
-		*apiKey,
-		5*time.Second, // Send every 5 seconds
-		100,           // or when batch size reaches 100
-	)
+	processor := newProcessor()
+	metricsServer := serveMetrics(receiver, processor)
+	console := serveConsole(processor)
+	wllServer, wll := serveWeatherLink(processor)
 
 	defer func() {
-		// First, cancel async reading to stop the goroutine
-		dev.CancelAsync()
+		if metricsServer != nil {
+			_ = metricsServer.Close()
+		}
+		if console != nil {
+			_ = console.Close()
+		}
+		if wllServer != nil {
+			_ = wllServer.Close()
+			_ = wll.Close()
+		}
 
 		// Close the hop channel to stop the frequency hopping goroutine
 		close(nextHop)
@@ -332,33 +298,35 @@ func main() {
 		// Wait for hop goroutine to finish
 		<-hopDone
 
-		// Close pipes after async is cancelled
-		out.Close()
-		in.Close()
+		// Stop streaming and release the sample source
+		if err := src.Close(); err != nil {
+			log.Printf("Error closing sample source: %v", err)
+		}
+
+		if rec != nil {
+			if err := rec.Close(); err != nil {
+				log.Printf("Error closing recording: %v", err)
+			}
+		}
 
 		// Stop the processor and send final data
 		processor.Stop()
-
-		// Finally close the device
-		dev.Close()
 	}()
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 
 	block := make([]byte, p.Cfg.BlockSize2)
-	initTransmitrs = true
-	maxFreq = p.ChannelCount
-
-	// Set the idLoopPeriods for one full rotation of the pattern + 1.
-	loopPeriod = time.Duration(maxFreq+2) * idLoopPeriods[actChan[maxChan-1]]
-	loopTimer := time.After(loopPeriod) // loopTimer of highest transmitter
-	log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/1000000000)
+	loopTimer := time.After(time.Until(step.Deadline))
+	metricsTicker := time.NewTicker(time.Second)
+	defer metricsTicker.Stop()
 
 	for {
 		select {
 		case <-sig:
 			return
+		case <-metricsTicker.C:
+			receiver.Update(sched, &p)
 		case <-loopTimer:
 			// If the loopTimer has expired one of two things has happened:
 			//     1: We've missed a message.
@@ -369,165 +337,116 @@ func main() {
 				if testNumber > 0 {
 					log.Printf("TESTFREQ %d: Frequency %d: NOK", testNumber, testChannelFreq)
 				}
-				loopPeriod = time.Duration(maxFreq+2) * idLoopPeriods[actChan[maxChan-1]]
-				loopTimer = time.After(loopPeriod)
+				loopTimer = time.After(syncPeriod)
 				nextHop <- p.SetHop(0, 0)
 			} else {
-				if !initTransmitrs {
-					// packet missed
-					curTime = time.Now().UnixNano()
-					// forget the handling of this channel; update lastVisitTime as if the packet was received
-					chLastVisits[expectedChanPtr] += int64(idLoopPeriods[actChan[expectedChanPtr]])
-					// update chLastHops as if the packet was received
-					chLastHops[expectedChanPtr] = (chLastHops[expectedChanPtr] + 1) % maxFreq
-					// increase missed counters
-					chAlarmCnts[expectedChanPtr]++
-					chMissPerFreq[actChan[expectedChanPtr]][p.SeqToHop(nextHopChan)]++
-					log.Printf("ID:%d packet missed (%d), missed per freq: %d", actChan[expectedChanPtr], chAlarmCnts[expectedChanPtr], chMissPerFreq[actChan[expectedChanPtr]][0:maxFreq])
-					for i := 0; i < maxChan; i++ {
-						if chAlarmCnts[i] > maxmissed {
-							chAlarmCnts[i] = 0 // reset current alarm count
-							initTransmitrs = true
-						}
-					}
-				}
-				// test again; situation may have changed
-				if !initTransmitrs {
-					HandleNextHopChannel()
-					nextHopChan = chNextHops[expectedChanPtr]
-					nextHopTran = actChan[expectedChanPtr]
-					loopPeriod = time.Duration(chNextVisits[expectedChanPtr] - curTime + int64(62500*time.Microsecond) + int64((receiveWindow+ex)*1000000))
-					loopTimer = time.After(loopPeriod)
-					nextHop <- p.SetHop(nextHopChan, nextHopTran)
-				} else {
-					// reset chLastVisits
-					for i := 0; i < maxChan; i++ {
-						chLastVisits[i] = 0
-					}
-					visitCount = 0
-					totInit++
-					loopPeriod = time.Duration(maxFreq+2) * idLoopPeriods[actChan[maxChan-1]]
-					loopTimer = time.After(loopPeriod)
-					log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/1000000000)
-					nextHop <- p.SetHop(0, 0)
-				}
+				step := sched.OnTimeout(time.Now())
+				loopTimer = time.After(time.Until(step.Deadline))
+				actHopChanIdx = step.Hop.ChannelIdx
+				nextHop <- step.Hop
 			}
 
 		default:
-			_, err := in.Read(block)
+			_, err := io.ReadFull(src, block)
 			if err != nil {
 				log.Printf("Error reading block: %v", err)
+				if err == io.EOF || err == io.ErrUnexpectedEOF || err == io.ErrClosedPipe {
+					return
+				}
+			}
+			if rec != nil {
+				if err := rec.WriteBlock(block); err != nil {
+					log.Printf("Error recording block: %v", err)
+				}
 			}
 
-			handleNxtPacket = false
+			var next *scheduler.Step
 			for _, msg := range p.Parse(p.Demodulate(block)) {
+				if rec != nil {
+					if err := rec.Message(msg); err != nil {
+						log.Printf("Error recording message: %v", err)
+					}
+				}
 				if testFreq {
 					if testNumber > 0 {
-						if msgIdToChan[int(msg.ID)] != 9 {
+						if sched.Listening(msg.ID) {
 							log.Printf("TESTFREQ %d: Frequency %d (freqCorr=%d): OK, msg.data: %02X", testNumber, testChannelFreq, freqCorr, msg.Data)
-							loopPeriod = time.Duration(maxFreq+2) * idLoopPeriods[actChan[maxChan-1]]
-							loopTimer = time.After(loopPeriod)
+							loopTimer = time.After(syncPeriod)
 							nextHop <- p.SetHop(0, 0)
 						}
 					}
 					continue // read next message
 				}
-				curTime = time.Now().UnixNano()
 				//log.Printf("msg.Data: %02X", msg.Data)
-				// Keep track of duplicate packets
-				seen := string(msg.Data)
-				if seen == lastRecMsg {
-					log.Printf("duplicate packet: %02X", msg.Data)
-					continue // read next message
+				kind, step := sched.OnPacket(msg, actHopChanIdx, time.Now())
+				if step != nil {
+					next = step
 				}
-				lastRecMsg = seen
-				// check if msg comes from undefined sensor
-				if msgIdToChan[int(msg.ID)] == 9 {
+				switch kind {
+				case scheduler.Duplicate:
+					log.Printf("duplicate packet: %02X", msg.Data)
+				case scheduler.Undefined:
 					if *undefined {
 						log.Printf("undefined: %02X ID=%d", msg.Data, msg.ID)
 					}
-					idUndefs[int(msg.ID)]++
-					continue // read next message
-				} else {
-					chTotMsgs[msgIdToChan[int(msg.ID)]]++
-					chAlarmCnts[msgIdToChan[int(msg.ID)]] = 0 // reset current missed count
-					if initTransmitrs {
-						if chLastVisits[msgIdToChan[int(msg.ID)]] == 0 {
-							visitCount += 1
-							chLastVisits[msgIdToChan[int(msg.ID)]] = curTime
-							chLastHops[msgIdToChan[int(msg.ID)]] = p.HopToSeq(actHopChanIdx)
-							log.Printf("TRANSMITTER %d SEEN", msg.ID)
-							if visitCount == maxChan {
-								if maxChan > 1 {
-									log.Printf("ALL TRANSMITTERS SEEN")
-								}
-								initTransmitrs = false
-								handleNxtPacket = true
-							}
-						} else {
-							chLastVisits[msgIdToChan[int(msg.ID)]] = curTime // update chLastVisits timer
-						}
+				case scheduler.InSync:
+					stats := sched.Stats()
+					chTotMsgs := make([]int, scheduler.MaxTransmitters)
+					copy(chTotMsgs, stats.Messages)
+					if *undefined {
+						log.Printf("%02X %d %d %d %d %d msg.ID=%d undefined:%d",
+							msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], stats.Inits, msg.ID, stats.Undefined)
+					} else if serverSrv != nil {
+						processor.AddMessage(msg)
 					} else {
-						// normal hopping
-						chLastHops[msgIdToChan[int(msg.ID)]] = p.HopToSeq(actHopChanIdx)
-						chLastVisits[msgIdToChan[int(msg.ID)]] = curTime
-						if *undefined {
-							log.Printf("%02X %d %d %d %d %d msg.ID=%d undefined:%d",
-								msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], totInit, msg.ID, idUndefs)
-						} else if serverSrv != nil {
-							processor.AddMessage(msg)
-						} else {
-							log.Printf("%02X %d %d %d %d %d msg.ID=%d",
-								msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], totInit, msg.ID)
-						}
-						handleNxtPacket = true
+						log.Printf("%02X %d %d %d %d %d msg.ID=%d",
+							msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], stats.Inits, msg.ID)
 					}
 				}
 			}
-			if handleNxtPacket {
-				HandleNextHopChannel()
-				nextHopChan = chNextHops[expectedChanPtr]
-				nextHopTran = actChan[expectedChanPtr]
-				loopPeriod = time.Duration(chNextVisits[expectedChanPtr] - curTime + int64(62500*time.Microsecond) + int64((receiveWindow+ex)*1000000))
-				loopTimer = time.After(loopPeriod)
-				nextHop <- p.SetHop(nextHopChan, nextHopTran)
+			if next != nil {
+				loopTimer = time.After(time.Until(next.Deadline))
+				actHopChanIdx = next.Hop.ChannelIdx
+				nextHop <- next.Hop
 			}
 		}
 	}
 }
 
-func HandleNextHopChannel() {
-	// calculate chNextVisits times
-	for i := 0; i < 8; i++ {
-		chNextVisits[i] = 0
-		chNextHops[i] = chLastHops[i]
-	}
-	// check lastVisits; zero values should not happen,
-	// but when it does the program will be very busy (c.q. hang)
-	for i := 0; i < maxChan; i++ {
-		if chLastVisits[i] == 0 {
-			log.Printf("ERROR: chLastVisits[%d] should not be zero!", i)
-			chLastVisits[i] = curTime // workaround to get further
-		}
+// replay runs a recording through the demodulator, parser and processor
+// as fast as possible and reports how many messages it found.
+func replay(path string) {
+	pl, err := recording.Open(path)
+	if err != nil {
+		log.Fatal(err)
 	}
-	for i := 0; i < 8; i++ {
-		if msgIdToChan[i] < 9 {
-			for chNextVisits[msgIdToChan[i]] = chLastVisits[msgIdToChan[i]]; chNextVisits[msgIdToChan[i]] <= curTime; chNextVisits[msgIdToChan[i]] += int64(idLoopPeriods[actChan[msgIdToChan[i]]]) {
-				chNextHops[msgIdToChan[i]] = (chNextHops[msgIdToChan[i]] + 1) % maxFreq
-			}
+	defer func() {
+		if err := pl.Close(); err != nil {
+			log.Printf("Error closing recording: %v", err)
 		}
+	}()
+
+	p := protocol.NewParser(14, pl.Header.TransmitterFreq)
+	p.SetRepair(repair)
+	p.Cfg.Log()
+	if p.Cfg.BlockSize2 != pl.Header.BlockSize || p.Cfg.SampleRate != pl.Header.SampleRate {
+		log.Fatalf("recording has block size %d at %d Hz, expected %d at %d Hz",
+			pl.Header.BlockSize, pl.Header.SampleRate, p.Cfg.BlockSize2, p.Cfg.SampleRate)
 	}
-	expectedChanPtr = Min(chNextVisits[0:maxChan])
-}
 
-func Min(values []int64) (ptr int) {
-	var min int64
-	min = values[0]
-	for i := 0; i < maxChan; i++ {
-		if values[i] < min {
-			min = values[i]
-			ptr = i
-		}
+	processor := newProcessor()
+
+	log.Printf("Replaying %s, recorded %s", path, pl.Start.Format(time.RFC3339))
+	stats, err := pl.Run(&p, func(msg protocol.Message) {
+		log.Printf("%02X msg.ID=%d rssi=%.1f snr=%.1f repaired=%d", msg.Data, msg.ID, msg.RSSI, msg.SNR, msg.Repaired)
+		processor.AddMessage(msg)
+	})
+	if err != nil {
+		log.Printf("Error replaying %s: %v", path, err)
 	}
-	return ptr
+
+	// Stop decodes every message still queued before the sinks' final
+	// send, so each replay of a recording gives the same output.
+	processor.Stop()
+	log.Printf("Replay finished: %s", stats)
 }
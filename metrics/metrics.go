@@ -0,0 +1,95 @@
+/*
+Package metrics serves the latest weather readings and the receiver's
+counters on /metrics in the Prometheus text exposition format.
+
+The format is simple enough to write by hand, which saves pulling in the
+Prometheus client library and its dependencies.
+*/
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Metric types.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// A Label is a name and value that tells samples of a family apart.
+type Label struct {
+	Name, Value string
+}
+
+// A Sample is one value of a family.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// A Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Write writes the families in the text exposition format, leaving out
+// families without samples.
+func Write(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		bw.WriteString("# HELP " + f.Name + " " + escape(f.Help, false) + "\n")
+		bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+			for i, l := range s.Labels {
+				if i == 0 {
+					bw.WriteByte('{')
+				} else {
+					bw.WriteByte(',')
+				}
+				bw.WriteString(l.Name + `="` + escape(l.Value, true) + `"`)
+			}
+			if len(s.Labels) > 0 {
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + strconv.FormatFloat(s.Value, 'g', -1, 64) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escape(s string, label bool) string {
+	if label {
+		return labelEscaper.Replace(s)
+	}
+	return helpEscaper.Replace(s)
+}
+
+// Handler returns a handler that writes the families of every source on
+// each request.
+func Handler(sources ...func() []Family) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var families []Family
+		for _, source := range sources {
+			families = append(families, source()...)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w, families)
+	})
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, Write(&b, []Family{
+		{Name: "a_total", Help: "Help with a \\ and\na newline.", Type: Counter, Samples: []Sample{{Value: 3}}},
+		{Name: "empty", Help: "Not written.", Type: Gauge},
+		{Name: "b", Help: "B.", Type: Gauge, Samples: []Sample{
+			{Labels: []Label{{"x", "1"}, {"y", `say "hi"`}}, Value: 1.5},
+			{Labels: []Label{{"x", "2"}}, Value: -0.25},
+		}},
+	}))
+	assert.Equal(t, `# HELP a_total Help with a \\ and\na newline.
+# TYPE a_total counter
+a_total 3
+# HELP b B.
+# TYPE b gauge
+b{x="1",y="say \"hi\""} 1.5
+b{x="2"} -0.25
+`, b.String())
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(
+		func() []Family { return []Family{{Name: "a", Type: Gauge, Samples: []Sample{{Value: 1}}}} },
+		func() []Family { return []Family{{Name: "b", Type: Gauge, Samples: []Sample{{Value: 2}}}} },
+	)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# HELP a \n# TYPE a gauge\na 1\n# HELP b \n# TYPE b gauge\nb 2\n", rec.Body.String())
+}
+
+func TestReceiver(t *testing.T) {
+	p := protocol.NewParser(14, "EU")
+	sched := scheduler.New(scheduler.Config{
+		Transmitters:  3,
+		ChannelCount:  p.ChannelCount,
+		MaxMissed:     4,
+		ReceiveWindow: 300 * time.Millisecond,
+	}, &p)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	sched.Start(now)
+	packet := func(id byte) protocol.Message {
+		return protocol.Message{Packet: dsp.Packet{Data: []byte{0x80 | id, 0, 0, 0, 0, 0, 0, 0}}, ID: id}
+	}
+	sched.OnPacket(packet(0), 0, now)
+	sched.OnPacket(packet(0), 0, now)
+	sched.OnPacket(packet(5), 0, now)
+	_, step := sched.OnPacket(packet(1), 0, now)
+	require.NotNil(t, step)
+	sched.OnTimeout(step.Deadline)
+
+	// All zeros pass the checksum, one bit flipped does not.
+	p.Parse([]dsp.Packet{{Data: []byte{0, 0, 1, 0, 0, 0, 0, 0, 0, 0}}})
+
+	r := NewReceiver()
+	r.Update(sched, &p)
+	r.SetFreqCorrection(protocol.Hop{Transmitter: 1, ChannelIdx: 3}, -1200)
+	r.SetFreqCorrection(protocol.Hop{Transmitter: 0, ChannelIdx: 4}, 250)
+
+	var b strings.Builder
+	require.NoError(t, Write(&b, r.Families()))
+	out := b.String()
+	for _, line := range []string{
+		`rtldavis_messages_total{transmitter="0"} 1`,
+		`rtldavis_messages_total{transmitter="1"} 1`,
+		`rtldavis_missed_total{transmitter="0",channel="2"} 1`,
+		`rtldavis_missed_in_a_row{transmitter="0"} 1`,
+		`rtldavis_undefined_total{transmitter="5"} 1`,
+		`rtldavis_duplicates_total 1`,
+		`rtldavis_crc_failures_total 1`,
+		`rtldavis_resyncs_total 0`,
+		`rtldavis_synchronized 1`,
+		"rtldavis_freq_correction_hz{transmitter=\"0\",channel=\"4\"} 250\nrtldavis_freq_correction_hz{transmitter=\"1\",channel=\"3\"} -1200\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+}
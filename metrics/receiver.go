@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/scheduler"
+)
+
+// Receiver holds a snapshot of the scheduler's and parser's counters.  The
+// receive loop updates it, so that scrapes never touch the hopping state.
+type Receiver struct {
+	mutex          sync.Mutex
+	stats          scheduler.Stats
+	synchronized   bool
+	crcFailures    int
+	freqCorrection map[[2]int]int // by transmitter and channel index
+}
+
+// NewReceiver returns a Receiver with no counts yet.
+func NewReceiver() *Receiver {
+	return &Receiver{freqCorrection: make(map[[2]int]int)}
+}
+
+// Update takes a snapshot of the counters.  Call it from the goroutine
+// that drives the scheduler and parser.
+func (r *Receiver) Update(sched *scheduler.HopScheduler, p *protocol.Parser) {
+	stats := sched.Stats()
+	synchronized := sched.Synchronized()
+	crcFailures := p.CRCFailures()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stats, r.synchronized, r.crcFailures = stats, synchronized, crcFailures
+}
+
+// SetFreqCorrection records the frequency correction applied on a hop.
+func (r *Receiver) SetFreqCorrection(hop protocol.Hop, hz int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.freqCorrection[[2]int{hop.Transmitter, hop.ChannelIdx}] = hz
+}
+
+// Families returns the counters as metric families.
+func (r *Receiver) Families() []Family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	messages := Family{Name: "rtldavis_messages_total", Help: "Messages received per transmitter.", Type: Counter}
+	missedInARow := Family{Name: "rtldavis_missed_in_a_row", Help: "Packets missed since the last one received, per transmitter.", Type: Gauge}
+	missed := Family{Name: "rtldavis_missed_total", Help: "Packets missed per transmitter and channel.", Type: Counter}
+	for i, id := range r.stats.Transmitters {
+		tr := Label{"transmitter", strconv.Itoa(id)}
+		messages.Samples = append(messages.Samples, Sample{[]Label{tr}, float64(r.stats.Messages[i])})
+		missedInARow.Samples = append(missedInARow.Samples, Sample{[]Label{tr}, float64(r.stats.MissedInARow[i])})
+		for ch, n := range r.stats.MissedPerFreq[i] {
+			missed.Samples = append(missed.Samples, Sample{[]Label{tr, {"channel", strconv.Itoa(ch)}}, float64(n)})
+		}
+	}
+
+	undefined := Family{Name: "rtldavis_undefined_total", Help: "Messages received from transmitters not listened to.", Type: Counter}
+	for id, n := range r.stats.Undefined {
+		undefined.Samples = append(undefined.Samples, Sample{[]Label{{"transmitter", strconv.Itoa(id)}}, float64(n)})
+	}
+
+	freqCorrection := Family{Name: "rtldavis_freq_correction_hz", Help: "Frequency correction applied on the last hop to a channel, per transmitter.", Type: Gauge}
+	keys := make([][2]int, 0, len(r.freqCorrection))
+	for k := range r.freqCorrection {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		freqCorrection.Samples = append(freqCorrection.Samples, Sample{
+			[]Label{{"transmitter", strconv.Itoa(k[0])}, {"channel", strconv.Itoa(k[1])}}, float64(r.freqCorrection[k]),
+		})
+	}
+
+	synchronized := 0.0
+	if r.synchronized {
+		synchronized = 1
+	}
+	return []Family{
+		messages,
+		missedInARow,
+		missed,
+		undefined,
+		{Name: "rtldavis_duplicates_total", Help: "Packets with the same data as the one before.", Type: Counter,
+			Samples: []Sample{{Value: float64(r.stats.Duplicates)}}},
+		{Name: "rtldavis_crc_failures_total", Help: "Packets dropped because the checksum failed.", Type: Counter,
+			Samples: []Sample{{Value: float64(r.crcFailures)}}},
+		{Name: "rtldavis_resyncs_total", Help: "Times the receiver lost the hop sequence and synchronized again.", Type: Counter,
+			Samples: []Sample{{Value: float64(r.stats.Inits)}}},
+		{Name: "rtldavis_synchronized", Help: "Whether the receiver follows the hop sequence of every transmitter.", Type: Gauge,
+			Samples: []Sample{{Value: synchronized}}},
+		freqCorrection,
+	}
+}
@@ -0,0 +1,192 @@
+// Package mqtt is a minimal MQTT 3.1.1 client, enough to publish messages
+// at QoS 0 or 1 over plain TCP.  QoS 2, subscriptions, TLS and automatic
+// reconnection are left out: the MQTT sink only publishes, and reconnects
+// itself on the next Send.  mqtttest has a broker stand-in for tests.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is how often the client pings the broker when it has
+	// nothing to publish; 0 turns keep-alive off.
+	KeepAlive time.Duration
+	// Timeout applies to connecting and to every acknowledgement.
+	Timeout time.Duration
+}
+
+// Client publishes to an MQTT broker.  It does not subscribe, so the only
+// packets it reads are acknowledgements.
+type Client struct {
+	opts Options
+	conn net.Conn
+	r    *bufio.Reader
+
+	mutex   sync.Mutex
+	nextID  uint16
+	written time.Time
+	done    chan struct{}
+}
+
+// Dial connects to the broker at addr (host:port).
+func Dial(addr string, opts Options) (*Client, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", addr, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{opts: opts, conn: conn, r: bufio.NewReader(conn), done: make(chan struct{})}
+
+	if err := c.connect(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if opts.KeepAlive > 0 {
+		go c.keepAlive()
+	}
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	flags := byte(0x02) // clean session
+	if c.opts.Username != "" {
+		flags |= 0x80
+	}
+	if c.opts.Password != "" {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = appendString(body, c.opts.ClientID)
+	if c.opts.Username != "" {
+		body = appendString(body, c.opts.Username)
+	}
+	if c.opts.Password != "" {
+		body = appendString(body, c.opts.Password)
+	}
+	if err := c.write(packet{typeConnect << 4, body}); err != nil {
+		return err
+	}
+
+	p, err := c.read(typeConnAck)
+	if err != nil {
+		return err
+	}
+	if len(p.body) != 2 {
+		return errors.New("mqtt: malformed CONNACK")
+	}
+	if p.body[1] != 0 {
+		return ConnectError(p.body[1])
+	}
+	return nil
+}
+
+func (c *Client) write(p packet) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(p.encode())
+	c.written = time.Now()
+	return err
+}
+
+// read reads the next packet, which must be of the given type.
+func (c *Client) read(kind byte) (packet, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.opts.Timeout)); err != nil {
+		return packet{}, err
+	}
+	p, err := readPacket(c.r)
+	if err != nil {
+		return p, err
+	}
+	if p.kind() != kind {
+		return p, fmt.Errorf("mqtt: expected packet type %d, got %d", kind, p.kind())
+	}
+	return p, nil
+}
+
+// Publish sends a message.  At QoS 1 it waits for the broker to
+// acknowledge it.  QoS 2 is not supported.
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return fmt.Errorf("mqtt: QoS %d is not supported", qos)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	if err := c.write(publishPacket(Message{topic, payload, qos, retain}, id)); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	p, err := c.read(typePubAck)
+	if err != nil {
+		return err
+	}
+	if len(p.body) != 2 || binary.BigEndian.Uint16(p.body) != id {
+		return errors.New("mqtt: PUBACK for the wrong message")
+	}
+	return nil
+}
+
+// Ping checks that the broker is still there.
+func (c *Client) Ping() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.write(packet{typePingReq << 4, nil}); err != nil {
+		return err
+	}
+	_, err := c.read(typePingResp)
+	return err
+}
+
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(c.opts.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mutex.Lock()
+			idle := time.Since(c.written) >= c.opts.KeepAlive/2
+			c.mutex.Unlock()
+			if idle {
+				if err := c.Ping(); err != nil {
+					// The next Publish will fail and report it.
+					return
+				}
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	close(c.done)
+	_ = c.write(packet{typeDisconnect << 4, nil})
+	return c.conn.Close()
+}
@@ -0,0 +1,72 @@
+package mqtt_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/mqtt"
+	"github.com/nathanmsmith/rtldavis/mqtt/mqtttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	b, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	c, err := mqtt.Dial(b.Addr, mqtt.Options{ClientID: "rtldavis", Username: "user", Password: "pass", KeepAlive: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, []mqtttest.Connect{{ClientID: "rtldavis", Username: "user", Password: "pass"}}, b.Connects())
+
+	require.NoError(t, c.Publish("davis/0/temperature", []byte("72.5"), 1, true))
+	require.NoError(t, c.Publish("davis/0/wind_speed", []byte("3"), 0, false))
+	require.NoError(t, c.Ping())
+	require.NoError(t, c.Close())
+
+	require.Eventually(t, func() bool { return len(b.Messages()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []mqtt.Message{
+		{Topic: "davis/0/temperature", Payload: []byte("72.5"), QoS: 1, Retain: true},
+		{Topic: "davis/0/wind_speed", Payload: []byte("3"), QoS: 0, Retain: false},
+	}, b.Messages())
+	assert.Contains(t, b.Retained(), "davis/0/temperature")
+}
+
+func TestPublishLargePayload(t *testing.T) {
+	b, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	c, err := mqtt.Dial(b.Addr, mqtt.Options{ClientID: "rtldavis"})
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	payload := strings.Repeat("{}", 10000)
+	require.NoError(t, c.Publish("davis/state", []byte(payload), 1, false))
+	assert.Equal(t, payload, string(b.Messages()[0].Payload))
+}
+
+func TestConnectRefused(t *testing.T) {
+	b, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+	b.Refuse = 5
+
+	_, err = mqtt.Dial(b.Addr, mqtt.Options{ClientID: "rtldavis"})
+	assert.Equal(t, mqtt.ConnectError(5), err)
+	assert.EqualError(t, err, "mqtt: connection refused: not authorized")
+}
+
+func TestPublishFailsWhenBrokerGoesAway(t *testing.T) {
+	b, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	c, err := mqtt.Dial(b.Addr, mqtt.Options{ClientID: "rtldavis", Timeout: time.Second})
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	b.DropClients()
+	assert.Error(t, c.Publish("davis/0/temperature", []byte("72.5"), 1, false))
+}
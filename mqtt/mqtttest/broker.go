@@ -0,0 +1,243 @@
+// Package mqtttest provides an in-process MQTT broker for tests.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/nathanmsmith/rtldavis/mqtt"
+)
+
+// Control packet types, the high nibble of the first byte.
+const (
+	typeConnect  = 1
+	typeConnAck  = 2
+	typePublish  = 3
+	typePubAck   = 4
+	typePingReq  = 12
+	typePingResp = 13
+)
+
+// Connect is a client's CONNECT as seen by the Broker.
+type Connect struct {
+	ClientID string
+	Username string
+	Password string
+}
+
+// Broker is an in-process stand-in for an MQTT broker, for tests.  It
+// keeps every message published to it and acknowledges those at QoS 1.
+type Broker struct {
+	Addr string
+	// Refuse makes the broker refuse connections with this code.
+	Refuse mqtt.ConnectError
+
+	listener net.Listener
+	mutex    sync.Mutex
+	connects []Connect
+	messages []mqtt.Message
+	conns    []net.Conn
+	wg       sync.WaitGroup
+}
+
+// NewBroker starts a broker on a free port of the loopback interface.
+func NewBroker() (*Broker, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{Addr: l.Addr().String(), listener: l}
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.conns = append(b.conns, conn)
+		b.mutex.Unlock()
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer func() { _ = conn.Close() }()
+			b.serve(conn)
+		}()
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != typeConnect {
+		return
+	}
+	b.mutex.Lock()
+	b.connects = append(b.connects, parseConnect(body))
+	refuse := b.Refuse
+	b.mutex.Unlock()
+	if _, err := conn.Write([]byte{typeConnAck << 4, 2, 0, byte(refuse)}); err != nil || refuse != 0 {
+		return
+	}
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		switch header >> 4 {
+		case typePublish:
+			m, id, err := parsePublish(header, body)
+			if err != nil {
+				return
+			}
+			b.mutex.Lock()
+			b.messages = append(b.messages, m)
+			b.mutex.Unlock()
+			if m.QoS == 0 {
+				continue
+			}
+			reply = binary.BigEndian.AppendUint16([]byte{typePubAck << 4, 2}, id)
+		case typePingReq:
+			reply = []byte{typePingResp << 4, 0}
+		default: // DISCONNECT, or something a publisher doesn't send
+			return
+		}
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// readPacket reads a control packet: its first byte and the rest.
+func readPacket(r *bufio.Reader) (header byte, body []byte, err error) {
+	if header, err = r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	// Remaining length: 7 bits per byte, least significant first.
+	length := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, errors.New("mqtttest: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body = make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// readString reads a length-prefixed string from the front of buf.
+func readString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, errors.New("mqtttest: short string")
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", nil, errors.New("mqtttest: short string")
+	}
+	return string(buf[2 : 2+n]), buf[2+n:], nil
+}
+
+func parsePublish(header byte, body []byte) (m mqtt.Message, id uint16, err error) {
+	m.QoS = (header >> 1) & 3
+	m.Retain = header&1 != 0
+	var rest []byte
+	if m.Topic, rest, err = readString(body); err != nil {
+		return m, 0, err
+	}
+	if m.QoS > 0 {
+		if len(rest) < 2 {
+			return m, 0, errors.New("mqtttest: short publish")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	m.Payload = append([]byte(nil), rest...)
+	return m, id, nil
+}
+
+func parseConnect(body []byte) (c Connect) {
+	_, rest, err := readString(body) // protocol name
+	if err != nil || len(rest) < 4 {
+		return c
+	}
+	flags := rest[1]
+	rest = rest[4:]
+	c.ClientID, rest, _ = readString(rest)
+	if flags&0x80 != 0 {
+		c.Username, rest, _ = readString(rest)
+	}
+	if flags&0x40 != 0 {
+		c.Password, _, _ = readString(rest)
+	}
+	return c
+}
+
+// Connects returns the CONNECTs received so far.
+func (b *Broker) Connects() []Connect {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]Connect(nil), b.connects...)
+}
+
+// Messages returns the messages published so far, in order.
+func (b *Broker) Messages() []mqtt.Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]mqtt.Message(nil), b.messages...)
+}
+
+// Retained returns the last retained message of every topic.
+func (b *Broker) Retained() map[string]mqtt.Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	retained := make(map[string]mqtt.Message)
+	for _, m := range b.messages {
+		if m.Retain {
+			retained[m.Topic] = m
+		}
+	}
+	return retained
+}
+
+// DropClients closes every client connection, as a broker restart would.
+func (b *Broker) DropClients() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.conns = nil
+}
+
+// Close stops the broker.
+func (b *Broker) Close() error {
+	err := b.listener.Close()
+	b.DropClients()
+	b.wg.Wait()
+	return err
+}
@@ -0,0 +1,19 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 300000} {
+		p := packet{typePublish << 4, bytes.Repeat([]byte{'x'}, n)}
+		got, err := readPacket(bufio.NewReader(bytes.NewReader(p.encode())))
+		require.NoError(t, err)
+		assert.Equal(t, n, len(got.body))
+	}
+}
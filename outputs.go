@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/config"
+	"github.com/nathanmsmith/rtldavis/metrics"
+	"github.com/nathanmsmith/rtldavis/mqtt"
+	"github.com/nathanmsmith/rtldavis/processor"
+	"github.com/nathanmsmith/rtldavis/spool"
+	"github.com/nathanmsmith/rtldavis/vantage"
+	"github.com/nathanmsmith/rtldavis/weatherlink"
+)
+
+// newProcessor returns a weather processor sending to every configured
+// output.
+func newProcessor() *processor.WeatherProcessor {
+	wp := processor.NewWeatherProcessor(100)
+	if h := cfg.Outputs.HTTP; h != nil {
+		var sink processor.Sink = processor.NewHTTPSink(h.URL, h.APIKey)
+		if sp := h.Spool; sp != nil {
+			queue, err := spool.Open(sp.Dir, int64(sp.MaxMB)<<20)
+			if err != nil {
+				log.Fatalf("Error opening spool: %v", err)
+			}
+			log.Printf("Spooling undelivered data in %s, %d waiting", sp.Dir, queue.Len())
+			sink = processor.NewDurableSink(sink, queue, 5*time.Second, sp.MaxBackoff)
+		}
+		wp.AddSink(sink, h.Interval)
+	}
+	if m := cfg.Outputs.MQTT; m != nil {
+		opts := mqtt.Options{
+			ClientID:  m.ClientID,
+			Username:  m.Username,
+			Password:  m.Password,
+			KeepAlive: time.Minute,
+		}
+		sink := processor.NewMQTTSink(m.Broker, opts, m.Prefix, byte(m.QoS), m.Retain)
+		if m.HomeAssistant {
+			sink.DiscoveryPrefix = m.DiscoveryPrefix
+			for _, t := range cfg.Transmitters {
+				sink.Devices = append(sink.Devices, processor.HADevice{
+					ID:      byte(t.ID),
+					Name:    t.Name,
+					Model:   t.Model(),
+					Sensors: t.Sensors(),
+				})
+			}
+		}
+		wp.AddTransmitterSink(sink, m.Interval)
+	}
+	if g := cfg.Outputs.Graphite; g != nil {
+		format := processor.Graphite{Prefix: g.Prefix, Names: g.Names}
+		if g.Addr == "-" {
+			wp.AddTransmitterSink(processor.NewWriterSink(os.Stdout, format), g.Interval)
+		} else {
+			wp.AddTransmitterSink(processor.NewGraphiteSink(g.Addr, format), g.Interval)
+		}
+	}
+	if w := cfg.Outputs.Wunderground; w != nil {
+		sink := processor.NewWundergroundSink(w.StationID, w.Key)
+		if w.URL != "" {
+			sink.URL = w.URL
+		}
+		wp.AddSink(sink, w.Interval)
+	}
+	if a := cfg.Outputs.APRS; a != nil {
+		var pos *processor.Position
+		if a.Latitude != nil && a.Longitude != nil {
+			pos = &processor.Position{Lat: *a.Latitude, Lon: *a.Longitude}
+		}
+		wp.AddSink(processor.NewAPRSSink(a.Server, a.Callsign, *a.Passcode, pos), a.Interval)
+	}
+	if i := cfg.Outputs.Influx; i != nil {
+		if i.URL != "" {
+			wp.AddTransmitterSink(processor.NewInfluxHTTPSink(i.URL, i.Token), i.Interval)
+		} else {
+			wp.AddTransmitterSink(processor.NewInfluxUDPSink(i.UDP), i.Interval)
+		}
+	}
+	return wp
+}
+
+// serveConsole emulates a Vantage console if configured and returns the
+// server, or nil.
+func serveConsole(wp *processor.WeatherProcessor) *vantage.Server {
+	v := cfg.Outputs.Vantage
+	if v == nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", v.Listen)
+	if err != nil {
+		log.Fatalf("Error serving Vantage console: %v", err)
+	}
+	stationType := byte(vantage.VantagePro2)
+	if t, ok := cfg.Transmitter(0); ok && t.Type == config.TypeVue {
+		stationType = vantage.VantageVue
+	}
+	srv := vantage.NewServer(wp.Latest, stationType)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error serving Vantage console: %v", err)
+		}
+	}()
+	log.Printf("Emulating a Vantage console on %s", ln.Addr())
+	return srv
+}
+
+// serveWeatherLink emulates a WeatherLink Live if configured and returns
+// the HTTP server and the broadcaster, or nil.
+func serveWeatherLink(wp *processor.WeatherProcessor) (*http.Server, *weatherlink.Server) {
+	w := cfg.Outputs.WeatherLink
+	if w == nil {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", w.Listen)
+	if err != nil {
+		log.Fatalf("Error serving WeatherLink Live API: %v", err)
+	}
+	wll := weatherlink.NewServer(wp.Latest, w.DID, w.Broadcast)
+	srv := &http.Server{Handler: wll, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			log.Printf("Error serving WeatherLink Live API: %v", err)
+		}
+	}()
+	log.Printf("Emulating a WeatherLink Live on http://%s/v1/current_conditions", ln.Addr())
+	return srv, wll
+}
+
+// serveMetrics serves /metrics if configured and returns the server, or
+// nil.
+func serveMetrics(receiver *metrics.Receiver, wp *processor.WeatherProcessor) *http.Server {
+	m := cfg.Outputs.Metrics
+	if m == nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", m.Listen)
+	if err != nil {
+		log.Fatalf("Error serving metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(receiver.Families, func() []metrics.Family {
+		return processor.MetricFamilies(wp.LatestByTransmitter())
+	}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			log.Printf("Error serving metrics: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on http://%s/metrics", ln.Addr())
+	return srv
+}
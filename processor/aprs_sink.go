@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// CWOPServer is the APRS-IS server for Citizen Weather Observer Program
+// stations.
+const CWOPServer = "cwop.aprs.net:14580"
+
+// Position is a station's location in decimal degrees, north and east
+// positive.
+type Position struct {
+	Lat, Lon float64
+}
+
+// aprsCoordinates formats the position as DDMM.mmN/DDDMM.mmW; the / picks
+// the primary symbol table, whose _ is the weather station symbol.
+func (p Position) aprsCoordinates() string {
+	lat, ns := p.Lat, 'N'
+	if lat < 0 {
+		lat, ns = -lat, 'S'
+	}
+	lon, ew := p.Lon, 'E'
+	if lon < 0 {
+		lon, ew = -lon, 'W'
+	}
+	// Round to hundredths of a minute first, so that 59.999 carries over.
+	latMin := math.Round(lat * 6000)
+	lonMin := math.Round(lon * 6000)
+	return fmt.Sprintf("%02d%05.2f%c/%03d%05.2f%c",
+		int(latMin)/6000, math.Mod(latMin, 6000)/100, ns,
+		int(lonMin)/6000, math.Mod(lonMin, 6000)/100, ew)
+}
+
+// APRSWeather returns an APRS weather report of data from call, sent at
+// the time given.  With a position it is a position report with the
+// weather station symbol, otherwise a positionless weather report.
+// Readings that are missing are left out, except wind and temperature,
+// which are required and sent as dots.  The gust is the highest wind speed
+// of the last PeakWindWindow.
+func APRSWeather(call string, pos *Position, data WeatherDatum, at time.Time) string {
+	at = at.UTC()
+	var b strings.Builder
+	b.WriteString(call + ">APRS,TCPIP*:")
+
+	dir, speed, gust := "...", "...", "..."
+	if w := data.Wind; w != nil {
+		dir = fmt.Sprintf("%03d", (int(w.Direction)+359)%360+1)
+		speed = fmt.Sprintf("%03d", w.Speed)
+	}
+	if w := data.PeakWind; w != nil {
+		gust = fmt.Sprintf("%03d", w.Speed)
+	}
+	if pos != nil {
+		b.WriteString("@" + at.Format("021504") + "z" + pos.aprsCoordinates() + "_" + dir + "/" + speed)
+	} else {
+		b.WriteString("_" + at.Format("01021504") + "c" + dir + "s" + speed)
+	}
+	b.WriteString("g" + gust)
+
+	if t := data.Temperature; t != nil {
+		b.WriteString(aprsNumber('t', float64(t.Value), 1, 3))
+	} else {
+		b.WriteString("t...")
+	}
+	if r := data.RainTotals; r != nil {
+		b.WriteString(aprsNumber('r', float64(r.LastHour), 100, 3))
+		b.WriteString(aprsNumber('p', float64(r.Last24h), 100, 3))
+		b.WriteString(aprsNumber('P', float64(r.Daily), 100, 3))
+	}
+	if h := data.Humidity; h != nil {
+		// Two digits, 00 stands for 100%.
+		n := int(math.Round(math.Max(float64(h.Value), 1)))
+		b.WriteString(fmt.Sprintf("h%02d", n%100))
+	}
+	if s := data.SolarRadiation; s != nil {
+		// L for up to 999 W/m², l for the thousands and up.
+		if s.Value < 999.5 {
+			b.WriteString(aprsNumber('L', float64(s.Value), 1, 3))
+		} else {
+			b.WriteString(aprsNumber('l', float64(s.Value)-1000, 1, 3))
+		}
+	}
+	b.WriteString("rtldavis")
+	return b.String()
+}
+
+// aprsNumber formats field followed by v*scale with width digits, or a
+// minus sign and one digit less if negative.
+func aprsNumber(field byte, v, scale float64, width int) string {
+	n := int(math.Round(v * scale))
+	if n < 0 {
+		return fmt.Sprintf("%c-%0*d", field, width-1, -n)
+	}
+	return fmt.Sprintf("%c%0*d", field, width, n)
+}
+
+// APRSSink submits weather reports to an APRS-IS server such as CWOP's.
+// It logs in with the callsign and passcode, sends one report with the
+// latest readings and disconnects, as CWOP asks stations to.  CWOP
+// stations without a ham license use passcode -1.
+type APRSSink struct {
+	Server   string
+	Callsign string
+	Passcode int
+	Position *Position
+
+	latest WeatherDatum // merged from every Send
+}
+
+func NewAPRSSink(server, callsign string, passcode int, pos *Position) *APRSSink {
+	return &APRSSink{
+		Server:   server,
+		Callsign: strings.ToUpper(callsign),
+		Passcode: passcode,
+		Position: pos,
+	}
+}
+
+func (s *APRSSink) Name() string {
+	return "aprs"
+}
+
+// Ready waits for a temperature, like a console does.
+func (s *APRSSink) Ready(data WeatherDatum) bool {
+	return !data.empty() && (data.Temperature != nil || s.latest.Temperature != nil)
+}
+
+func (s *APRSSink) Send(data WeatherDatum) error {
+	latest := merge(s.latest, data)
+	sentAt := data.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Server, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return err
+	}
+
+	// The server greets with a comment line, then answers the login
+	// with "# logresp <call> verified|unverified, server <name>".
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("reading APRS-IS banner: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "user %s pass %d vers rtldavis 0.15\r\n", s.Callsign, s.Passcode); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("logging in to APRS-IS: %w", err)
+		}
+		if strings.HasPrefix(line, "# logresp") {
+			if strings.Contains(line, " unverified") && s.Passcode != -1 {
+				return fmt.Errorf("APRS-IS did not accept the passcode: %s: %w", strings.TrimSpace(line), ErrRejected)
+			}
+			break
+		}
+	}
+	if _, err := fmt.Fprintf(conn, "%s\r\n", APRSWeather(s.Callsign, s.Position, latest, sentAt)); err != nil {
+		return err
+	}
+	s.latest = latest
+	return nil
+}
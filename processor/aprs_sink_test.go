@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var aprsTime = time.Date(2025, 3, 9, 23, 45, 0, 0, time.UTC)
+
+func TestAPRSWeather(t *testing.T) {
+	data := WeatherDatum{
+		Temperature: &TemperatureDatum{Value: 77.4},
+		Humidity:    &HumidityDatum{Value: 50},
+		Wind:        &WindDatum{Speed: 4, Direction: 220},
+		PeakWind:    &PeakWindDatum{Speed: 5},
+		RainTotals:  &RainTotalsDatum{LastHour: 0.01, Last24h: 0.2, Daily: 0.15},
+
+		SolarRadiation: &SolarRadiationDatum{Value: 596},
+	}
+
+	pos := &Position{Lat: 49.058333, Lon: -72.029167}
+	assert.Equal(t, "CW1234>APRS,TCPIP*:@092345z4903.50N/07201.75W_220/004g005t077r001p020P015h50L596rtldavis",
+		APRSWeather("CW1234", pos, data, aprsTime))
+	assert.Equal(t, "CW1234>APRS,TCPIP*:_03092345c220s004g005t077r001p020P015h50L596rtldavis",
+		APRSWeather("CW1234", nil, data, aprsTime))
+
+	cold := WeatherDatum{
+		Temperature: &TemperatureDatum{Value: -5.2},
+		Humidity:    &HumidityDatum{Value: 100},
+		Wind:        &WindDatum{Speed: 0, Direction: 0},
+
+		SolarRadiation: &SolarRadiationDatum{Value: 1106},
+	}
+	assert.Equal(t, "N0CALL>APRS,TCPIP*:@092345z3352.08S/15112.50E_360/000g...t-05h00l106rtldavis",
+		APRSWeather("N0CALL", &Position{Lat: -33.868, Lon: 151.2083}, cold, aprsTime))
+	assert.Equal(t, "N0CALL>APRS,TCPIP*:_03092345c...s...g...t...rtldavis",
+		APRSWeather("N0CALL", nil, WeatherDatum{}, aprsTime))
+}
+
+// aprsServer accepts one connection, greets, checks the login and
+// returns the report sent.
+func aprsServer(t *testing.T, login, logresp string) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	reports := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("# aprsc 2.1.19\r\n"))
+		r := bufio.NewReader(conn)
+		line, _ := r.ReadString('\n')
+		assert.Equal(t, login+"\r\n", line)
+		_, _ = conn.Write([]byte(logresp + "\r\n"))
+		report, _ := r.ReadString('\n')
+		reports <- strings.TrimSpace(report)
+	}()
+	return ln.Addr().String(), reports
+}
+
+func TestAPRSSink(t *testing.T) {
+	addr, reports := aprsServer(t, "user CW1234 pass -1 vers rtldavis 0.15", "# logresp CW1234 unverified, server CWOP-1")
+	sink := NewAPRSSink(addr, "cw1234", -1, nil)
+	assert.False(t, sink.Ready(WeatherDatum{Wind: &WindDatum{}}), "waits for a temperature")
+
+	require.NoError(t, sink.Send(WeatherDatum{
+		Temperature: &TemperatureDatum{Value: 60},
+		Wind:        &WindDatum{Speed: 2, Direction: 90},
+		SentAt:      aprsTime,
+	}))
+	assert.Equal(t, "CW1234>APRS,TCPIP*:_03092345c090s002g...t060rtldavis", <-reports)
+	assert.True(t, sink.Ready(WeatherDatum{Wind: &WindDatum{}}))
+}
+
+func TestAPRSSinkRejectsPasscode(t *testing.T) {
+	addr, _ := aprsServer(t, "user N0CALL pass 12345 vers rtldavis 0.15", "# logresp N0CALL unverified, server T2TEST")
+	sink := NewAPRSSink(addr, "N0CALL", 12345, nil)
+	err := sink.Send(WeatherDatum{Temperature: &TemperatureDatum{Value: 60}})
+	assert.ErrorIs(t, err, ErrRejected)
+}
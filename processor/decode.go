@@ -38,6 +38,12 @@ func GetMessageType(m protocol.Message) byte {
 	return (m.Data[0] >> 4) & 0x0F
 }
 
+// rawValue returns the 10 bit value that UV, solar radiation and the
+// voltages are sent as: byte 3 and the top two bits of byte 4.
+func rawValue(m protocol.Message) int16 {
+	return (int16(m.Data[3])<<2 | int16(m.Data[4])>>6) & 0x3FF
+}
+
 // func DecodeMsg(m Message) (packet DecodedPacket) {
 // 	packet.ReceivedAt = time.Now()
 //
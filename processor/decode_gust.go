@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// Return the highest wind speed of the last ten minutes in mph, as the ISS
+// measured it, and the raw gust index.
+func DecodeGust(m protocol.Message) (speed int16, index byte, err error) {
+	// From Dekay (https://github.com/dekay/DavisRFM69/wiki/Message-Protocol):
+	// Byte 3 is the gust speed in mph, the highest of the last ten minutes.
+	// The upper nibble of byte 5 is the gust index, which Luc and Matthew
+	// Wall log without interpreting ("???"). Nobody documents what it
+	// means, so it is only logged: resolving the gust direction from it
+	// waits until a source says what it is, and publishing it as it is
+	// would invite guesses.
+	// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+	// https://github.com/matthewwall/weewx-meteostick/blob/master/bin/user/meteostick.py
+	//
+	// The ISS sees every wind sample, not just the ones it transmits, so
+	// this catches gusts between packets.
+
+	slog.Info("Gust reading received", "raw_byte_data", bytesToSpacedHex(m.Data))
+	if GetMessageType(m) != 0x09 {
+		return -1, 0, errors.New("message does not have gust")
+	}
+
+	return int16(m.Data[3]), m.Data[5] >> 4, nil
+}
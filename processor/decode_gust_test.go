@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeGust(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		speed int16
+		index byte
+		err   string
+	}{
+		// Captures from an ISS.
+		{"index 8", []byte{0x90, 0x03, 0x8e, 0x0a, 0x61, 0x8a, 0x90, 0x0c}, 10, 8, ""},
+		{"index 9", []byte{0x90, 0x04, 0xb3, 0x0a, 0xc3, 0x9a, 0x8b, 0x9a}, 10, 9, ""},
+		// Built from the documented layout with valid checksums.
+		{"strong", []byte{0x90, 0x12, 0x5c, 0x1f, 0x00, 0x0a, 0x7a, 0x6c}, 31, 0, ""},
+		{"calm", []byte{0x90, 0x00, 0x5c, 0x00, 0x00, 0x3a, 0x63, 0xb4}, 0, 3, ""},
+		{"index passed on as it is", []byte{0x90, 0x12, 0x5c, 0x1f, 0x00, 0xfa, 0x95, 0x73}, 31, 15, ""},
+		{"not gust", []byte{0xa0, 0x01, 0x3a, 0x80, 0x3b, 0x00, 0xed, 0x0e}, -1, 0, "message does not have gust"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speed, index, err := DecodeGust(createMessage(tt.data))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.speed, speed)
+			assert.Equal(t, tt.index, index)
+		})
+	}
+}
+
+func TestProcessGust(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	// Wind from 150° at 4 mph, then a 31 mph gust in a packet that also
+	// carries wind from 130° at 18 mph.
+	process(t, wp, []byte{0x80, 0x04, 0x6a, 0x33, 0x8d, 0x00, 0x25, 0x11},
+		[]byte{0x90, 0x12, 0x5c, 0x1f, 0x00, 0x0a, 0x7a, 0x6c})
+	data := wp.Latest()
+	require.NotNil(t, data.Gust)
+	assert.Equal(t, int16(31), data.Gust.Speed)
+	require.NotNil(t, data.PeakWind)
+	assert.Equal(t, int16(31), data.PeakWind.Speed, "the ISS gust beats the wind speeds heard")
+	assert.Equal(t, int16(130), data.PeakWind.Direction, "the fastest wind heard, as the gust has no direction")
+}
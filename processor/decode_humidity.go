@@ -3,11 +3,25 @@ package processor
 import (
 	"errors"
 	"log/slog"
+	"math"
 
 	"github.com/nathanmsmith/rtldavis/protocol"
 )
 
-func DecodeHumidity(m protocol.Message) (float32, error) {
+// HumiditySensor is the kind of humidity sensor in an ISS, told apart by the
+// low nibble of byte 4.
+type HumiditySensor string
+
+const (
+	HumidityDigitalA HumiditySensor = "digital_a" // low nibble 0xD
+	HumidityDigitalB HumiditySensor = "digital_b" // low nibble 0xB
+	HumidityDigitalC HumiditySensor = "digital_c" // low nibble 0x9
+	HumidityDigital  HumiditySensor = "digital"   // any other with bit 3 set, like Dekay's 0x8
+	HumidityAnalog   HumiditySensor = "analog"    // bit 3 clear, 0x5 in Luc's example
+)
+
+// Return the relative humidity in percent and the sensor that measured it.
+func DecodeHumidity(m protocol.Message) (float32, HumiditySensor, error) {
 	// From Dekay (https://github.com/dekay/im-me/blob/master/pocketwx/src/protocol.txt):
 	// >Humidity is represented as two bytes in Byte 3 and Byte 4 as a ten bit value.
 	// >Bits 5 and 4 in Byte 4 are the two most significant bits.  Byte 3 is the
@@ -19,12 +33,47 @@ func DecodeHumidity(m protocol.Message) (float32, error) {
 	// https://www.carluccio.de/davis-vue-hacking-part-2/
 	// https://github.com/kobuki/VPTools/blob/61e39ac9c561d439939bd8bbe1b9e77b72b7be27/Examples/ISSRx/ISSRx.ino#L156-L158
 	// https://github.com/dcbo/ISS-MQTT-Gateway/blob/master/src/main.cpp
+	//
+	// Luc lists three digital sensor variants and an analog one, told apart
+	// by the low nibble of byte 4. He decodes every variant with bit 3 of
+	// byte 4 set as tenths of a percent, and the analog sensor, with it
+	// clear, with a linear fit. 0 means no sensor. Nobody documents a
+	// different formula for any digital variant, so the variant is only
+	// reported.
+	// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+	//
+	// # A0 00 00 C9 3D 00 2A 87 (digital sensor, variant a)
+	// # A0 01 3A 80 3B 00 ED 0E (digital sensor, variant b)
+	// # A0 01 41 7F 39 00 18 65 (digital sensor, variant c)
+	// # A0 00 00 22 85 00 ED E3 (analog sensor)
+	// # A1 00 DB 00 03 00 47 C7 (no sensor)
 
 	slog.Info("Humidity reading received", "raw_byte_data", bytesToSpacedHex(m.Data))
 	if GetMessageType(m) != 0x0A {
-		return -1, errors.New("message does not have humidity")
+		return -1, "", errors.New("message does not have humidity")
+	}
+
+	raw := (int16(m.Data[4]>>4))<<8 | int16(m.Data[3])
+	if raw == 0 {
+		return -1, "", errors.New("no sensor")
+	}
+
+	if m.Data[4]&0x08 == 0 {
+		// The fit goes past 100% when the air is saturated.
+		humidity := math.Min(math.Max(float64(raw)*-0.301+710.23, 0), 100)
+		return float32(math.Round(humidity*10) / 10), HumidityAnalog, nil
+	}
+
+	sensor := HumidityDigital
+	switch m.Data[4] & 0x0F {
+	case 0x0D:
+		sensor = HumidityDigitalA
+	case 0x0B:
+		sensor = HumidityDigitalB
+	case 0x09:
+		sensor = HumidityDigitalC
 	}
 
-	humidity := float32((int16(m.Data[4]>>4))<<8|int16(m.Data[3])) / 10.0
-	return humidity, nil
+	humidity := float32(raw) / 10.0
+	return humidity, sensor, nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Example from Dekay
@@ -12,7 +13,56 @@ import (
 // ((0x38 >> 4) << 8) + 0x83 = 131 + 768 = 899 = 89.9% Relative Humidity
 func TestDecodeHumidity(t *testing.T) {
 	message := createMessage([]byte{0xA0, 0x06, 0x52, 0x83, 0x38, 0x00, 0x5a, 0xC8})
-	humidity, err := DecodeHumidity(message)
+	humidity, sensor, err := DecodeHumidity(message)
 	assert.NoError(t, err)
 	assert.Equal(t, float32(89.9), humidity)
+	assert.Equal(t, HumidityDigital, sensor)
+}
+
+// Sensor variants from Luc
+// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+func TestDecodeHumiditySensors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		humidity float32
+		sensor   HumiditySensor
+		err      string
+	}{
+		// ((0x3d >> 4) << 8) + 0xc9 = 969
+		{"digital variant a", []byte{0xA0, 0x00, 0x00, 0xC9, 0x3D, 0x00, 0x2A, 0x87}, 96.9, HumidityDigitalA, ""},
+		// ((0x3b >> 4) << 8) + 0x80 = 896
+		{"digital variant b", []byte{0xA0, 0x01, 0x3A, 0x80, 0x3B, 0x00, 0xED, 0x0E}, 89.6, HumidityDigitalB, ""},
+		// ((0x39 >> 4) << 8) + 0x7f = 895
+		{"digital variant c", []byte{0xA0, 0x01, 0x41, 0x7F, 0x39, 0x00, 0x18, 0x65}, 89.5, HumidityDigitalC, ""},
+		// ((0x85 >> 4) << 8) + 0x22 = 2082, 2082 * -0.301 + 710.23 = 83.548
+		{"analog", []byte{0xA0, 0x00, 0x00, 0x22, 0x85, 0x00, 0xED, 0xE3}, 83.5, HumidityAnalog, ""},
+		// Not a capture. ((0x65 >> 4) << 8) + 0x00 = 1536, 1536 * -0.301 + 710.23 = 247.9
+		{"analog saturated", []byte{0xA0, 0x00, 0x00, 0x00, 0x65, 0x00, 0x15, 0xF7}, 100, HumidityAnalog, ""},
+		{"no sensor", []byte{0xA1, 0x00, 0xDB, 0x00, 0x03, 0x00, 0x47, 0xC7}, -1, "", "no sensor"},
+		{"not humidity", []byte{0x80, 0x00, 0x00, 0xC9, 0x3D, 0x00, 0x2A, 0x87}, -1, "", "message does not have humidity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			humidity, sensor, err := DecodeHumidity(createMessage(tt.data))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.humidity, humidity)
+			assert.Equal(t, tt.sensor, sensor)
+		})
+	}
+}
+
+func TestProcessHumiditySensor(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	process(t, wp, []byte{0xA0, 0x01, 0x41, 0x7F, 0x39, 0x00, 0x18, 0x65})
+	humidity := wp.Latest().Humidity
+	require.NotNil(t, humidity)
+	assert.Equal(t, float32(89.5), humidity.Value)
+	assert.Equal(t, HumidityDigitalC, humidity.Sensor)
 }
@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// Return the solar radiation in W/m², to the whole watt like the console
+// shows it.
+func DecodeSolarRadiation(m protocol.Message) (float32, error) {
+	// Dekay documents solar radiation as a ten bit value in byte 3 and the
+	// top two bits of byte 4, like UV. Each step is 1.757936 W/m². An ISS
+	// without a solar radiation sensor sends 0x3FF. Luc also ignores 0x3FE,
+	// which is not a valid reading.
+	// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-6-solar-radiation
+	//
+	// Luc and Matthew Wall decode it the same way.
+	// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+	// https://github.com/matthewwall/weewx-meteostick/blob/master/bin/user/meteostick.py
+
+	slog.Info("Solar radiation reading received", "raw_byte_data", bytesToSpacedHex(m.Data))
+	if GetMessageType(m) != 0x06 {
+		return -1, errors.New("message does not have solar radiation")
+	}
+
+	raw := rawValue(m)
+	switch raw {
+	case 0x3FF:
+		return -1, errors.New("no sensor")
+	case 0x3FE:
+		return -1, errors.New("invalid reading")
+	}
+
+	radiation := math.Round(float64(raw) * 1.757936)
+	return float32(radiation), nil
+}
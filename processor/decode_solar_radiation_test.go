@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSolarRadiation(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		radiation float32
+		err       string
+	}{
+		// These are not captures: nobody here has a solar radiation sensor.
+		// They are built from the documented layout with valid checksums.
+		//
+		// 0x54 << 2 | 0xc0 >> 6 = 339, 339 * 1.757936 = 595.9
+		{"sunny", []byte{0x60, 0x05, 0x93, 0x54, 0xc5, 0x00, 0x4a, 0xa3}, 596, ""},
+		// 0x0b << 2 | 0x40 >> 6 = 45, 45 * 1.757936 = 79.1
+		{"overcast", []byte{0x60, 0x02, 0x87, 0x0b, 0x45, 0x00, 0x95, 0x46}, 79, ""},
+		{"night", []byte{0x60, 0x00, 0x8c, 0x00, 0x05, 0x00, 0x32, 0xe7}, 0, ""},
+		// 0x3FD, the largest reading: 1021 * 1.757936 = 1794.9
+		{"largest", []byte{0x60, 0x03, 0x90, 0xff, 0x45, 0x00, 0x4a, 0x0f}, 1795, ""},
+		{"invalid", []byte{0x60, 0x03, 0x90, 0xff, 0x85, 0x00, 0x5c, 0x5b}, -1, "invalid reading"},
+		{"no sensor", []byte{0x60, 0x03, 0x90, 0xff, 0xc5, 0x00, 0x51, 0x97}, -1, "no sensor"},
+		{"not solar radiation", []byte{0x70, 0x01, 0xf5, 0xce, 0x43, 0x86, 0x58, 0xe2}, -1, "message does not have solar radiation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radiation, err := DecodeSolarRadiation(createMessage(tt.data))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.radiation, radiation)
+		})
+	}
+}
+
+func TestProcessSolarRadiation(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	process(t, wp, []byte{0x60, 0x05, 0x93, 0x54, 0xc5, 0x00, 0x4a, 0xa3})
+	solar := wp.Latest().SolarRadiation
+	require.NotNil(t, solar)
+	assert.Equal(t, float32(596), solar.Value)
+	assert.Nil(t, wp.Latest().Solar, "solar radiation is not the solar panel voltage")
+}
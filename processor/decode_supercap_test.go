@@ -23,13 +23,13 @@ func TestBatteryLowFlagSet(t *testing.T) {
 	pkt := dsp.Packet{
 		Idx: 0,
 		Data: []byte{
-			0x00, 0x00,       // Skipped by NewMessage
-			0x28,             // Message type 0x02, battery low=true, ID=0
-			0x00,             // Wind speed
-			0x00,             // Wind direction
-			0xE1,             // Supercap voltage byte 3
-			0x00,             // Supercap voltage byte 4
-			0x00, 0x00,       // Padding
+			0x00, 0x00, // Skipped by NewMessage
+			0x28,       // Message type 0x02, battery low=true, ID=0
+			0x00,       // Wind speed
+			0x00,       // Wind direction
+			0xE1,       // Supercap voltage byte 3
+			0x00,       // Supercap voltage byte 4
+			0x00, 0x00, // Padding
 		},
 	}
 
@@ -59,13 +59,13 @@ func TestBatteryLowFlagNotSet(t *testing.T) {
 	pkt := dsp.Packet{
 		Idx: 0,
 		Data: []byte{
-			0x00, 0x00,       // Skipped by NewMessage
-			0x20,             // Message type 0x02, battery low=false, ID=0
-			0x00,             // Wind speed
-			0x00,             // Wind direction
-			0xE1,             // Supercap voltage byte 3
-			0x00,             // Supercap voltage byte 4
-			0x00, 0x00,       // Padding
+			0x00, 0x00, // Skipped by NewMessage
+			0x20,       // Message type 0x02, battery low=false, ID=0
+			0x00,       // Wind speed
+			0x00,       // Wind direction
+			0xE1,       // Supercap voltage byte 3
+			0x00,       // Supercap voltage byte 4
+			0x00, 0x00, // Padding
 		},
 	}
 
@@ -87,20 +87,20 @@ func TestBatteryLowFlagNotSet(t *testing.T) {
 // correctly populates the IsLow field in BatteryDatum
 func TestBatteryDatumPopulatesIsLow(t *testing.T) {
 	// Create a weather processor
-	wp := NewWeatherProcessor("http://localhost:8080", "test-key", 5_000_000_000, 10)
+	wp := NewWeatherProcessor(10)
 	defer wp.Stop()
 
 	// Test with battery low = true
 	pktLow := dsp.Packet{
 		Idx: 0,
 		Data: []byte{
-			0x00, 0x00,       // Skipped by NewMessage
-			0x28,             // Message type 0x02, battery low=true, ID=0
-			0x00,             // Wind speed
-			0x00,             // Wind direction
-			0xE1,             // Supercap voltage byte 3
-			0x00,             // Supercap voltage byte 4
-			0x00, 0x00,       // Padding
+			0x00, 0x00, // Skipped by NewMessage
+			0x28,       // Message type 0x02, battery low=true, ID=0
+			0x00,       // Wind speed
+			0x00,       // Wind direction
+			0xE1,       // Supercap voltage byte 3
+			0x00,       // Supercap voltage byte 4
+			0x00, 0x00, // Padding
 		},
 	}
 	messageLow := protocol.NewMessage(pktLow)
@@ -123,13 +123,13 @@ func TestBatteryDatumPopulatesIsLow(t *testing.T) {
 	pktOk := dsp.Packet{
 		Idx: 0,
 		Data: []byte{
-			0x00, 0x00,       // Skipped by NewMessage
-			0x20,             // Message type 0x02, battery low=false, ID=0
-			0x00,             // Wind speed
-			0x00,             // Wind direction
-			0xE1,             // Supercap voltage byte 3
-			0x00,             // Supercap voltage byte 4
-			0x00, 0x00,       // Padding
+			0x00, 0x00, // Skipped by NewMessage
+			0x20,       // Message type 0x02, battery low=false, ID=0
+			0x00,       // Wind speed
+			0x00,       // Wind direction
+			0xE1,       // Supercap voltage byte 3
+			0x00,       // Supercap voltage byte 4
+			0x00, 0x00, // Padding
 		},
 	}
 	messageOk := protocol.NewMessage(pktOk)
@@ -2,6 +2,8 @@ package processor
 
 import (
 	"errors"
+	"fmt"
+	"math"
 
 	"log/slog"
 
@@ -28,21 +30,42 @@ func DecodeTemperature(m protocol.Message) (float32, error) {
 	// # 80 00 00 33 8D 00 25 11 (digital temp)
 	// # 81 00 00 59 45 00 A3 E6 (analog temp)
 	// # 81 00 DB FF C3 00 AB F8 (no sensor)
+	//
+	// Older ISS units measure temperature with a thermistor. Bit 3 of byte 4
+	// is clear for those, and the top ten bits of the value are the A/D
+	// reading. Luc converts it to the thermistor resistance and then to a
+	// temperature with the Steinhart-Hart equation, using Davis' constants.
+	// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+	// https://github.com/cmatteri/CC1101-Weather-Receiver/wiki/Soil-Moisture-Station-Protocol
 
 	slog.Info("Temperature reading received", "raw_byte_data", bytesToSpacedHex(m.Data))
 	if GetMessageType(m) != 0x08 {
 		return -1, errors.New("message does not have temperature")
 	}
 
-	if m.Data[4]&0x08 == 0 {
-		return -1, errors.New("temperature reading is not from digital sensor. Analog sensor not supported")
-	}
-
 	raw := (int16(m.Data[3]) << 4) + (int16(m.Data[4]) >> 4)
 	if raw == 0x0FFC {
 		return -1, errors.New("no sensor")
 	}
 
+	if m.Data[4]&0x08 == 0 {
+		return analogTemperature(raw)
+	}
+
 	temperature := float32(raw) / 10.0
 	return temperature, nil
 }
+
+// analogTemperature converts the reading of an analog sensor to °F, to a
+// tenth of a degree.
+func analogTemperature(raw int16) (float32, error) {
+	adc := float64(raw) / 4
+	kOhms := 18.81099 / (1/adc - 0.0009988027) / 1000
+	if adc <= 0 || kOhms <= 0 {
+		return -1, fmt.Errorf("analog temperature reading %d out of range", raw)
+	}
+
+	celsius := 1/(0.002783573+0.0002509406*math.Log(kOhms)) - 273
+	fahrenheit := celsius*9/5 + 32
+	return float32(math.Round(fahrenheit*10) / 10), nil
+}
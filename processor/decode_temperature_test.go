@@ -30,7 +30,25 @@ func TestDecodeTemperatureAnalogSensor(t *testing.T) {
 	message := createMessage([]byte{0x81, 0x00, 0x00, 0x59, 0x45, 0x00, 0xA3, 0xE6})
 
 	temp, err := DecodeTemperature(message)
-	assert.ErrorContains(t, err, "temperature reading is not from digital sensor. Analog sensor not supported")
+	assert.NoError(t, err)
+	assert.Equal(t, float32(74.4), temp)
+}
+
+func TestDecodeTemperatureAnalogSensorNoSensor(t *testing.T) {
+	message := createMessage([]byte{0x81, 0x00, 0xDB, 0xFF, 0xC3, 0x00, 0xAB, 0xF8})
+
+	temp, err := DecodeTemperature(message)
+	assert.ErrorContains(t, err, "no sensor")
+	assert.Equal(t, float32(-1.0), temp)
+}
+
+func TestDecodeTemperatureAnalogSensorOutOfRange(t *testing.T) {
+	// Not a capture. 0xFF << 4 | 0x0 = 4080, or 1020 from the A/D: past
+	// where the thermistor formula gives a resistance.
+	message := createMessage([]byte{0x81, 0x00, 0x00, 0xFF, 0x05, 0x00, 0xA1, 0x16})
+
+	temp, err := DecodeTemperature(message)
+	assert.ErrorContains(t, err, "out of range")
 	assert.Equal(t, float32(-1.0), temp)
 }
 
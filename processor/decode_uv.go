@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// Return the UV index, to a tenth like the console shows it.
+func DecodeUVIndex(m protocol.Message) (float32, error) {
+	// Dekay documents the UV index as a ten bit value in byte 3 and the top
+	// two bits of byte 4, divided by 50. An ISS without a UV sensor sends
+	// 0x3FF.
+	// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-4-uv-index
+	//
+	// Luc and Matthew Wall decode it the same way.
+	// https://github.com/lheijst/weewx-rtldavis/blob/master/bin/user/rtldavis.py
+	// https://github.com/matthewwall/weewx-meteostick/blob/master/bin/user/meteostick.py
+
+	slog.Info("UV index reading received", "raw_byte_data", bytesToSpacedHex(m.Data))
+	if GetMessageType(m) != 0x04 {
+		return -1, errors.New("message does not have UV index")
+	}
+
+	raw := rawValue(m)
+	if raw == 0x3FF {
+		return -1, errors.New("no sensor")
+	}
+
+	uv := math.Round(float64(raw)/50.0*10) / 10
+	return float32(uv), nil
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeUVIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		uv   float32
+		err  string
+	}{
+		// These are built from the documented layout with valid checksums,
+		// not captured from a UV sensor.
+		//
+		// 0x2A << 2 | 0x80 >> 6 = 170, 170 / 50 = 3.4
+		{"moderate", []byte{0x40, 0x04, 0x8b, 0x2a, 0x80, 0x00, 0x7a, 0xae}, 3.4, ""},
+		// 0x00 << 2 | 0x40 >> 6 = 1, 1 / 50 = 0.02
+		{"night", []byte{0x40, 0x04, 0x8b, 0x00, 0x45, 0x00, 0xd2, 0x08}, 0, ""},
+		// 0x7d << 2 | 0xc0 >> 6 = 503, 503 / 50 = 10.06
+		{"extreme", []byte{0x40, 0x04, 0x8b, 0x7d, 0xc5, 0x00, 0x53, 0xc9}, 10.1, ""},
+		// The low six bits of byte 4 aren't part of the reading.
+		{"low bits ignored", []byte{0x40, 0x04, 0x8b, 0x2a, 0xbf, 0x00, 0x6f, 0x05}, 3.4, ""},
+		{"no sensor", []byte{0x40, 0x04, 0x8b, 0xff, 0xc5, 0x00, 0x06, 0xf3}, -1, "no sensor"},
+		{"not UV", []byte{0x60, 0x04, 0x8b, 0x2a, 0x80, 0x00, 0x4f, 0xa6}, -1, "message does not have UV index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uv, err := DecodeUVIndex(createMessage(tt.data))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.uv, uv)
+		})
+	}
+}
+
+func TestProcessUVIndex(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	uvMsg := []byte{0x40, 0x04, 0x8b, 0x2a, 0x80, 0x00, 0x7a, 0xae}
+	process(t, wp, uvMsg)
+	uv := wp.Latest().UV
+	require.NotNil(t, uv)
+	assert.Equal(t, float32(3.4), uv.Value)
+	assert.Equal(t, "40 04 8b 2a 80 00 7a ae", uv.RawMessage)
+
+	// A reading without a sensor keeps the last one.
+	process(t, wp, []byte{0x40, 0x04, 0x8b, 0xff, 0xc5, 0x00, 0x06, 0xf3})
+	assert.Same(t, uv, wp.Latest().UV)
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"math"
+	"time"
+)
+
+// RainPerClick is the rain in inches per tip of the bucket sold in North
+// America.
+const RainPerClick = 0.01
+
+// PeakWindWindow is how far back PeakWindDatum looks for the highest wind
+// speed, as consoles do for the gust.
+const PeakWindWindow = 10 * time.Minute
+
+// DewPointDatum is the dew point in °F, from the latest temperature and
+// humidity of one transmitter.
+type DewPointDatum struct {
+	Value       float32   `json:"value"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// RainTotalsDatum is the rain in inches since local midnight, in the last
+// hour and in the last 24 hours, counted from the bucket tips since
+// startup.
+type RainTotalsDatum struct {
+	Daily       float32   `json:"daily"`
+	LastHour    float32   `json:"last_hour"`
+	Last24h     float32   `json:"last_24h"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// PeakWindDatum is the highest wind speed in mph over the last
+// PeakWindWindow and its direction, and the average speed over it.  The
+// gust the ISS reports counts too, as it catches gusts between packets,
+// but the direction stays that of the fastest wind heard as the gust has
+// none.
+type PeakWindDatum struct {
+	Speed       int16     `json:"speed"`
+	Direction   int16     `json:"direction"`
+	Average     float32   `json:"average"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// DewPoint returns the dew point in °F with the Magnus formula, which is
+// within 0.4 °F between -45 °C and 60 °C.
+func DewPoint(tempF, humidity float64) float64 {
+	const b, c = 17.62, 243.12
+	t := (tempF - 32) * 5 / 9
+	gamma := math.Log(humidity/100) + b*t/(c+t)
+	return c*gamma/(b-gamma)*9/5 + 32
+}
+
+// rainCounter turns the bucket tip counter of the ISS, which wraps at 128,
+// into rain totals.
+type rainCounter struct {
+	last  int16 // -1 before the first reading
+	day   time.Time
+	daily int
+	tips  []tips // in the last 24 hours
+}
+
+type tips struct {
+	at time.Time
+	n  int
+}
+
+func newRainCounter() *rainCounter {
+	return &rainCounter{last: -1}
+}
+
+// add counts the tips since the previous reading of the counter.
+func (c *rainCounter) add(clicks int16, at time.Time) {
+	y, m, d := at.Date()
+	if day := time.Date(y, m, d, 0, 0, 0, 0, at.Location()); !day.Equal(c.day) {
+		c.day = day
+		c.daily = 0
+	}
+	if c.last >= 0 && clicks != c.last {
+		n := int((clicks - c.last + 128) % 128)
+		c.daily += n
+		c.tips = append(c.tips, tips{at, n})
+	}
+	c.last = clicks
+}
+
+// since returns the tips in the period before now.
+func (c *rainCounter) since(now time.Time, period time.Duration) (n int) {
+	for len(c.tips) > 0 && !c.tips[0].at.After(now.Add(-24*time.Hour)) {
+		c.tips = c.tips[1:]
+	}
+	for _, t := range c.tips {
+		if t.at.After(now.Add(-period)) {
+			n += t.n
+		}
+	}
+	return n
+}
+
+// peakWind keeps the wind readings of the last PeakWindWindow.
+type peakWind struct {
+	winds []WindDatum
+}
+
+// add adds a reading and returns the peak and the average speed.
+func (p *peakWind) add(w WindDatum) (peak WindDatum, average float64) {
+	p.winds = append(p.winds, w)
+	for !p.winds[0].ReceivedAt.After(w.ReceivedAt.Add(-PeakWindWindow)) {
+		p.winds = p.winds[1:]
+	}
+	peak = p.winds[0]
+	for _, w := range p.winds {
+		if w.Speed >= peak.Speed {
+			peak = w
+		}
+		average += float64(w.Speed)
+	}
+	return peak, average / float64(len(p.winds))
+}
+
+// derive updates the values computed from several readings after a
+// message from transmitter id.
+func (wp *WeatherProcessor) derive(id byte, at time.Time) {
+	d := &wp.data
+	if d.Wind != nil && d.Wind.Transmitter == id {
+		p := wp.peakWind[id]
+		if p == nil {
+			p = &peakWind{}
+			wp.peakWind[id] = p
+		}
+		peak, average := p.add(*d.Wind)
+		if g := d.Gust; g != nil && g.Transmitter == id && g.Speed > peak.Speed &&
+			g.ReceivedAt.After(at.Add(-PeakWindWindow)) {
+			peak.Speed = g.Speed
+		}
+		d.PeakWind = &PeakWindDatum{
+			Speed:       peak.Speed,
+			Direction:   peak.Direction,
+			Average:     float32(math.Round(average*10) / 10),
+			Transmitter: id,
+			ReceivedAt:  at,
+		}
+	}
+	if t, h := d.Temperature, d.Humidity; t != nil && h != nil && t.Transmitter == h.Transmitter &&
+		(t.ReceivedAt.Equal(at) || h.ReceivedAt.Equal(at)) && h.Value > 0 {
+		d.DewPoint = &DewPointDatum{
+			Value:       float32(math.Round(DewPoint(float64(t.Value), float64(h.Value))*10) / 10),
+			Transmitter: t.Transmitter,
+			ReceivedAt:  at,
+		}
+	}
+	if r := d.Rainfall; r != nil && r.ReceivedAt.Equal(at) {
+		c := wp.rain[r.Transmitter]
+		if c == nil {
+			c = newRainCounter()
+			wp.rain[r.Transmitter] = c
+		}
+		c.add(r.TotalClicks, at)
+		inches := func(clicks int) float32 {
+			return float32(math.Round(float64(clicks)*RainPerClick*100) / 100)
+		}
+		d.RainTotals = &RainTotalsDatum{
+			Daily:       inches(c.daily),
+			LastHour:    inches(c.since(at, time.Hour)),
+			Last24h:     inches(c.since(at, 24*time.Hour)),
+			Transmitter: r.Transmitter,
+			ReceivedAt:  at,
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDewPoint(t *testing.T) {
+	for _, tt := range []struct {
+		tempF, humidity, dewPoint float64
+	}{
+		{68, 100, 68},
+		{68, 50, 48.7},
+		{90, 70, 78.9},
+		{32, 80, 26.6},
+		{-4, 60, -14.4},
+	} {
+		assert.InDelta(t, tt.dewPoint, DewPoint(tt.tempF, tt.humidity), 0.2, "%.0f°F %.0f%%", tt.tempF, tt.humidity)
+	}
+}
+
+func TestRainCounter(t *testing.T) {
+	c := newRainCounter()
+	at := time.Date(2025, 3, 1, 22, 30, 0, 0, time.UTC)
+
+	c.add(120, at)
+	assert.Equal(t, 0, c.daily, "the first reading only sets the counter")
+	c.add(125, at.Add(10*time.Minute))
+	c.add(3, at.Add(20*time.Minute)) // wrapped
+	assert.Equal(t, 11, c.daily)
+	assert.Equal(t, 11, c.since(at.Add(20*time.Minute), time.Hour))
+	assert.Equal(t, 6, c.since(at.Add(70*time.Minute), time.Hour))
+
+	// Midnight starts a new day.
+	c.add(4, at.Add(90*time.Minute))
+	assert.Equal(t, 1, c.daily)
+	assert.Equal(t, 1, c.since(at.Add(90*time.Minute), time.Hour))
+	assert.Equal(t, 12, c.since(at.Add(90*time.Minute), 24*time.Hour))
+	assert.Equal(t, 1, c.since(at.Add(24*time.Hour+25*time.Minute), 24*time.Hour))
+}
+
+func TestPeakWind(t *testing.T) {
+	var p peakWind
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	wind := func(speed int16, after time.Duration) WindDatum {
+		return WindDatum{Speed: speed, Direction: speed * 10, ReceivedAt: at.Add(after)}
+	}
+
+	peak, average := p.add(wind(5, 0))
+	assert.Equal(t, int16(5), peak.Speed)
+	assert.Equal(t, 5.0, average)
+	peak, _ = p.add(wind(12, time.Minute))
+	assert.Equal(t, int16(12), peak.Speed)
+	peak, average = p.add(wind(4, 5*time.Minute))
+	assert.Equal(t, int16(12), peak.Speed)
+	assert.Equal(t, int16(120), peak.Direction)
+	assert.Equal(t, 7.0, average)
+	peak, average = p.add(wind(2, 11*time.Minute))
+	assert.Equal(t, int16(4), peak.Speed, "the gust is forgotten after ten minutes")
+	assert.Equal(t, 3.0, average)
+}
+
+func TestProcessorDerivesValues(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	process(t, wp, temperatureMsg, humidityMsg, []byte{0xE0, 0x02, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00},
+		[]byte{0xE0, 0x08, 0x00, 0x13, 0x00, 0x00, 0x00, 0x00})
+	data := wp.Latest()
+	require.NotNil(t, data.DewPoint)
+	assert.InDelta(t, DewPoint(float64(data.Temperature.Value), float64(data.Humidity.Value)), data.DewPoint.Value, 0.05)
+	require.NotNil(t, data.RainTotals)
+	assert.Equal(t, float32(0.03), data.RainTotals.Daily)
+	require.NotNil(t, data.PeakWind)
+	assert.Equal(t, int16(8), data.PeakWind.Speed)
+}
+
+func TestProcessorDerivesValuesPerTransmitter(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	defer wp.Stop()
+
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, m := range []struct {
+		id   byte
+		data []byte
+	}{
+		{0, []byte{0xE0, 0x02, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00}},
+		{1, []byte{0xE1, 0x14, 0x00, 0x64, 0x00, 0x00, 0x00, 0x00}},
+		{0, []byte{0xE0, 0x08, 0x00, 0x13, 0x00, 0x00, 0x00, 0x00}},
+		{1, []byte{0xE1, 0x03, 0x00, 0x64, 0x00, 0x00, 0x00, 0x00}},
+	} {
+		message := createMessage(m.data)
+		message.ID = m.id
+		message.ReceivedAt = at.Add(time.Duration(i) * time.Second)
+		wp.AddMessage(message)
+	}
+	require.Eventually(t, func() bool {
+		wind := wp.LatestByTransmitter()[1].Wind
+		return wind != nil && wind.Speed == 3
+	}, time.Second, time.Millisecond)
+
+	latest := wp.LatestByTransmitter()
+	require.NotNil(t, latest[0].RainTotals)
+	assert.Equal(t, float32(0.03), latest[0].RainTotals.Daily)
+	require.NotNil(t, latest[1].RainTotals)
+	assert.Equal(t, float32(0), latest[1].RainTotals.Daily, "no tips between the counters of two buckets")
+	require.NotNil(t, latest[0].PeakWind)
+	assert.Equal(t, int16(8), latest[0].PeakWind.Speed, "the wind of the other transmitter does not count")
+	require.NotNil(t, latest[1].PeakWind)
+	assert.Equal(t, int16(20), latest[1].PeakWind.Speed)
+}
@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"log/slog"
+
+	"github.com/nathanmsmith/rtldavis/spool"
+)
+
+// ErrRejected is wrapped by sinks whose destination refused the data for
+// good, such as a 400 or 422 status.  Retrying won't help.
+var ErrRejected = errors.New("rejected")
+
+// DurableSink queues the weather data on disk and delivers it to Sink in
+// order, retrying with exponential backoff while Sink fails.  An outage
+// leads to a backfill instead of a gap.
+type DurableSink struct {
+	Sink  Sink
+	queue *spool.Queue
+
+	minBackoff, maxBackoff time.Duration
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewDurableSink delivers the data queued in queue, including what an
+// earlier run left, to sink.
+func NewDurableSink(sink Sink, queue *spool.Queue, minBackoff, maxBackoff time.Duration) *DurableSink {
+	s := &DurableSink{
+		Sink:       sink,
+		queue:      queue,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go s.run()
+	s.notify()
+	return s
+}
+
+func (s *DurableSink) Name() string {
+	return s.Sink.Name()
+}
+
+func (s *DurableSink) Ready(data WeatherDatum) bool {
+	if r, ok := s.Sink.(ReadySink); ok {
+		return r.Ready(data)
+	}
+	return !data.empty()
+}
+
+// Send queues data.  It only fails if the data can't be written to disk.
+func (s *DurableSink) Send(data WeatherDatum) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := s.queue.Push(payload); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func (s *DurableSink) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops delivering, leaving the queue for the next run, and closes
+// Sink.
+func (s *DurableSink) Close() error {
+	close(s.done)
+	<-s.stopped
+	if c, ok := s.Sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *DurableSink) run() {
+	defer close(s.stopped)
+
+	var backoff time.Duration
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-s.wake:
+			if retry != nil {
+				continue // wait for the backoff
+			}
+		case <-retry:
+			retry = nil
+		case <-s.done:
+			return
+		}
+
+		if s.deliver() {
+			backoff = 0
+			continue
+		}
+		backoff = min(max(2*backoff, s.minBackoff), s.maxBackoff)
+		slog.Info("Delivery failed, will retry", "sink", s.Name(), "queued", s.queue.Len(), "backoff", backoff)
+		retry = time.After(backoff)
+	}
+}
+
+// deliver sends the queue to Sink until it is empty or Sink fails.
+func (s *DurableSink) deliver() bool {
+	for {
+		select {
+		case <-s.done:
+			return true
+		default:
+		}
+
+		id, payload, ok, err := s.queue.Peek()
+		if !ok {
+			return true
+		}
+		var data WeatherDatum
+		if err == nil {
+			err = json.Unmarshal(payload, &data)
+		}
+		if err != nil {
+			slog.Error("Dropping unreadable spooled data", "sink", s.Name(), "error", err)
+		} else if err := s.Sink.Send(data); errors.Is(err, ErrRejected) {
+			slog.Error("Dropping rejected data", "sink", s.Name(), "error", err, "payload", payload)
+		} else if err != nil {
+			slog.Error("Error sending spooled data", "sink", s.Name(), "error", err)
+			return false
+		}
+
+		if err := s.queue.Remove(id); err != nil {
+			slog.Error("Error removing spooled data", "sink", s.Name(), "error", err)
+			return false
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/spool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func temperatureAt(v float32) WeatherDatum {
+	return WeatherDatum{Temperature: &TemperatureDatum{Value: v}}
+}
+
+func TestDurableSinkBackfillsInOrder(t *testing.T) {
+	queue, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	inner := &fakeSink{fail: true}
+	sink := NewDurableSink(inner, queue, time.Millisecond, 20*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sink.Send(temperatureAt(float32(i))), "queued while the server is down")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, inner.received())
+	assert.Equal(t, 5, queue.Len())
+
+	inner.setFail(false)
+	require.Eventually(t, func() bool { return len(inner.received()) == 5 }, time.Second, time.Millisecond)
+	for i, data := range inner.received() {
+		assert.Equal(t, float32(i), data.Temperature.Value)
+	}
+	assert.Equal(t, 0, queue.Len())
+	require.NoError(t, sink.Close())
+}
+
+func TestDurableSinkResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := spool.Open(dir, 0)
+	require.NoError(t, err)
+	sink := NewDurableSink(&fakeSink{fail: true}, queue, time.Hour, time.Hour)
+	require.NoError(t, sink.Send(temperatureAt(1)))
+	require.NoError(t, sink.Send(temperatureAt(2)))
+	require.NoError(t, sink.Close())
+
+	queue, err = spool.Open(dir, 0)
+	require.NoError(t, err)
+	inner := &fakeSink{}
+	sink = NewDurableSink(inner, queue, time.Hour, time.Hour)
+	require.Eventually(t, func() bool { return len(inner.received()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, float32(1), inner.received()[0].Temperature.Value)
+	require.NoError(t, sink.Close())
+}
+
+// rejectingSink refuses temperatures below zero for good.
+type rejectingSink struct {
+	fakeSink
+}
+
+func (s *rejectingSink) Send(data WeatherDatum) error {
+	if data.Temperature.Value < 0 {
+		return fmt.Errorf("invalid temperature: %w", ErrRejected)
+	}
+	return s.fakeSink.Send(data)
+}
+
+func TestDurableSinkDropsRejectedData(t *testing.T) {
+	queue, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	inner := &rejectingSink{}
+	sink := NewDurableSink(inner, queue, time.Hour, time.Hour)
+
+	require.NoError(t, sink.Send(temperatureAt(-1)))
+	require.NoError(t, sink.Send(temperatureAt(1)))
+	require.Eventually(t, func() bool { return len(inner.received()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, float32(1), inner.received()[0].Temperature.Value)
+	require.NoError(t, sink.Close())
+}
+
+func TestDurableSinkKeepsDataThroughAuthAndNotFoundErrors(t *testing.T) {
+	var mutex sync.Mutex
+	status := http.StatusUnauthorized
+	var got []float32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if status == http.StatusCreated {
+			var data WeatherDatum
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+			got = append(got, data.Temperature.Value)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	setStatus := func(s int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status = s
+	}
+	received := func() []float32 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]float32(nil), got...)
+	}
+
+	queue, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	sink := NewDurableSink(NewHTTPSink(server.URL, ""), queue, time.Millisecond, 5*time.Millisecond)
+	defer func() { _ = sink.Close() }()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Send(temperatureAt(float32(i))))
+	}
+	time.Sleep(20 * time.Millisecond)
+	setStatus(http.StatusNotFound)
+	for i := 3; i < 5; i++ {
+		require.NoError(t, sink.Send(temperatureAt(float32(i))))
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 5, queue.Len(), "nothing is dropped while the server refuses")
+
+	setStatus(http.StatusCreated)
+	require.Eventually(t, func() bool { return len(received()) == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, []float32{0, 1, 2, 3, 4}, received())
+	require.Eventually(t, func() bool { return queue.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestDurableSinkReadyFollowsSink(t *testing.T) {
+	queue, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	sink := NewDurableSink(NewHTTPSink("http://localhost:1", ""), queue, time.Hour, time.Hour)
+	defer func() { _ = sink.Close() }()
+
+	assert.False(t, sink.Ready(WeatherDatum{Wind: &WindDatum{}}))
+	assert.True(t, sink.Ready(temperatureAt(1)))
+}
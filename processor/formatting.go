@@ -2,6 +2,7 @@ package processor
 
 import (
 	"fmt"
+	"math"
 	"strings"
 )
 
@@ -16,3 +17,8 @@ func bytesToSpacedHex(data []byte) string {
 	}
 	return strings.Join(result, " ")
 }
+
+// round1 rounds to one decimal, enough for signal levels in dB.
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultGraphiteNames are the metric names mdickers47's fork used, by
+// field.  Other fields keep their own name.
+var DefaultGraphiteNames = map[string]string{
+	"temperature":    "temp",
+	"wind_speed":     "windspeed",
+	"wind_direction": "winddir",
+	"rain_rate":      "rainrate",
+}
+
+// Graphite formats readings in the Graphite plaintext protocol, one
+// metric, value and Unix time per line:
+//
+//	wx.davis.temp 50.20 1703133526
+//
+// Readings of transmitters other than ID 0 get the ID after the prefix,
+// as in wx.davis.1.temp.
+type Graphite struct {
+	Prefix string
+	// Names overrides the metric name of a field; an empty name leaves the
+	// field out.
+	Names map[string]string
+}
+
+// Lines returns the readings in data.
+func (g Graphite) Lines(data WeatherDatum) []byte {
+	var buf bytes.Buffer
+	for _, r := range readings(data) {
+		name, ok := g.Names[r.field]
+		if !ok {
+			if name, ok = DefaultGraphiteNames[r.field]; !ok {
+				name = r.field
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if g.Prefix != "" {
+			buf.WriteString(g.Prefix + ".")
+		}
+		if r.transmitter != 0 {
+			buf.WriteString(strconv.Itoa(int(r.transmitter)) + ".")
+		}
+		fmt.Fprintf(&buf, "%s %s %d\n", name, graphiteValue(r.value), r.receivedAt.Unix())
+	}
+	return buf.Bytes()
+}
+
+func graphiteValue(v any) string {
+	switch v := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', 2, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// GraphiteSink sends readings to a Graphite (carbon) plaintext listener
+// over TCP, reconnecting when the connection breaks.
+type GraphiteSink struct {
+	Graphite
+	Addr string
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func NewGraphiteSink(addr string, g Graphite) *GraphiteSink {
+	return &GraphiteSink{Graphite: g, Addr: addr}
+}
+
+func (s *GraphiteSink) Name() string {
+	return "graphite"
+}
+
+func (s *GraphiteSink) Send(data WeatherDatum) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.Addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	err := s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err == nil {
+		_, err = s.conn.Write(s.Lines(data))
+	}
+	if err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *GraphiteSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// WriterSink writes readings in the Graphite format to W, usually
+// standard output.
+type WriterSink struct {
+	Graphite
+	W io.Writer
+
+	mutex sync.Mutex
+}
+
+func NewWriterSink(w io.Writer, g Graphite) *WriterSink {
+	return &WriterSink{Graphite: g, W: w}
+}
+
+func (s *WriterSink) Name() string {
+	return "stdout"
+}
+
+func (s *WriterSink) Send(data WeatherDatum) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.W.Write(s.Lines(data))
+	return err
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphiteLines(t *testing.T) {
+	data := influxData
+	data.Humidity = &HumidityDatum{Value: 55.5, Transmitter: 2, ReceivedAt: time.Unix(1703133526, 0)}
+
+	g := Graphite{Prefix: "wx.davis", Names: map[string]string{"wind_direction": "dir", "snr": ""}}
+	assert.Equal(t, `wx.davis.1.temp 72.50 1700000000
+wx.davis.2.humidity 55.50 1703133526
+wx.davis.windspeed 3 1700000002
+wx.davis.dir 180 1700000002
+wx.davis.rssi -40.50 1700000002
+`, string(g.Lines(data)))
+}
+
+func TestWriterSink(t *testing.T) {
+	var b strings.Builder
+	sink := NewWriterSink(&b, Graphite{Prefix: "wx"})
+	require.NoError(t, sink.Send(WeatherDatum{
+		Temperature: &TemperatureDatum{Value: 50.2, ReceivedAt: time.Unix(1703133526, 0)},
+	}))
+	assert.Equal(t, "wx.temp 50.20 1703133526\n", b.String())
+}
+
+func TestGraphiteSinkReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	sink := NewGraphiteSink(ln.Addr().String(), Graphite{Prefix: "wx.davis"})
+	defer func() { _ = sink.Close() }()
+	data := WeatherDatum{Temperature: &TemperatureDatum{Value: 50.2, ReceivedAt: time.Unix(1703133526, 0)}}
+
+	require.NoError(t, sink.Send(data))
+	assert.Equal(t, "wx.davis.temp 50.20 1703133526", <-lines)
+
+	// A broken connection fails one send and is dialed again on the next.
+	_ = sink.conn.Close()
+	assert.Error(t, sink.Send(data))
+	require.NoError(t, sink.Send(data))
+	assert.Equal(t, "wx.davis.temp 50.20 1703133526", <-lines)
+}
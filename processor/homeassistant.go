@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// HADevice is a transmitter announced to Home Assistant, with the readings
+// it sends named as the MQTT topics.
+type HADevice struct {
+	ID      byte
+	Name    string
+	Model   string
+	Sensors []string
+}
+
+type haSensor struct {
+	component   string // sensor or binary_sensor
+	name        string
+	deviceClass string
+	unit        string
+	stateClass  string
+	diagnostic  bool
+}
+
+var haSensors = map[string]haSensor{
+	"temperature":     {"sensor", "Temperature", "temperature", "°F", "measurement", false},
+	"humidity":        {"sensor", "Humidity", "humidity", "%", "measurement", false},
+	"wind_speed":      {"sensor", "Wind speed", "wind_speed", "mph", "measurement", false},
+	"wind_direction":  {"sensor", "Wind direction", "", "°", "measurement", false},
+	"gust_speed":      {"sensor", "Gust speed", "wind_speed", "mph", "measurement", false},
+	"rain_rate":       {"sensor", "Rain rate", "precipitation_intensity", "in/h", "measurement", false},
+	"rain_clicks":     {"sensor", "Rain clicks", "", "", "total_increasing", false},
+	"uv_index":        {"sensor", "UV index", "", "UV index", "measurement", false},
+	"solar_radiation": {"sensor", "Solar radiation", "irradiance", "W/m²", "measurement", false},
+	"supercap":        {"sensor", "Supercap", "voltage", "V", "measurement", true},
+	"solar_voltage":   {"sensor", "Solar panel", "voltage", "V", "measurement", true},
+	"battery_low":     {"binary_sensor", "Battery", "battery", "", "", true},
+	"rssi":            {"sensor", "Signal strength", "signal_strength", "dB", "measurement", true},
+	"snr":             {"sensor", "Signal to noise ratio", "", "dB", "measurement", true},
+}
+
+// haExpireAfter marks readings unavailable in Home Assistant when the
+// transmitter hasn't been heard for this many seconds.
+const haExpireAfter = 600
+
+// discovery returns the Home Assistant discovery topics and configs of the
+// devices.
+func (s *MQTTSink) discovery() (topics []string, configs [][]byte, err error) {
+	for _, d := range s.Devices {
+		name := d.Name
+		if name == "" {
+			name = fmt.Sprintf("Davis transmitter %d", d.ID)
+		}
+		node := fmt.Sprintf("%s_%d", s.node(), d.ID)
+		device := map[string]any{
+			"identifiers":  []string{node},
+			"name":         name,
+			"manufacturer": "Davis Instruments",
+			"model":        d.Model,
+		}
+		for _, field := range d.Sensors {
+			sensor, ok := haSensors[field]
+			if !ok {
+				continue
+			}
+			config := map[string]any{
+				"name":         sensor.name,
+				"unique_id":    node + "_" + field,
+				"state_topic":  s.Topic(d.ID, field),
+				"expire_after": haExpireAfter,
+				"device":       device,
+			}
+			if sensor.deviceClass != "" {
+				config["device_class"] = sensor.deviceClass
+			}
+			if sensor.unit != "" {
+				config["unit_of_measurement"] = sensor.unit
+			}
+			if sensor.stateClass != "" {
+				config["state_class"] = sensor.stateClass
+			}
+			if sensor.diagnostic {
+				config["entity_category"] = "diagnostic"
+			}
+			if sensor.component == "binary_sensor" {
+				config["payload_on"] = "true"
+				config["payload_off"] = "false"
+			}
+			payload, err := json.Marshal(config)
+			if err != nil {
+				return nil, nil, err
+			}
+			topics = append(topics, fmt.Sprintf("%s/%s/%s/%s/config", s.DiscoveryPrefix, sensor.component, node, field))
+			configs = append(configs, payload)
+		}
+	}
+	return topics, configs, nil
+}
+
+// node names this receiver in unique IDs, so that two receivers don't
+// clash.
+func (s *MQTTSink) node() string {
+	if s.Options.ClientID != "" {
+		return s.Options.ClientID
+	}
+	return s.Prefix
+}
+
+// announce publishes the discovery configs, retained so that Home
+// Assistant finds them when it restarts.
+func (s *MQTTSink) announce() error {
+	topics, configs, err := s.discovery()
+	if err != nil {
+		return err
+	}
+	for i, topic := range topics {
+		if err := s.client.Publish(topic, configs[i], s.QoS, true); err != nil {
+			_ = s.client.Close()
+			s.client = nil
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"log/slog"
+)
+
+// HTTPSink POSTs the weather data as JSON to a server, which answers 201
+// Created.
+type HTTPSink struct {
+	serverURL  string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewHTTPSink(serverURL string, apiKey string) *HTTPSink {
+	return &HTTPSink{
+		serverURL: serverURL,
+		apiKey:    apiKey,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   10,
+				MaxConnsPerHost:       10,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				ForceAttemptHTTP2:     true,
+			},
+		},
+	}
+}
+
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+// Ready waits for a temperature, so that the server gets useful posts.
+func (s *HTTPSink) Ready(data WeatherDatum) bool {
+	return data.Temperature != nil
+}
+
+func (s *HTTPSink) Send(data WeatherDatum) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshaling data to JSON: %w", err)
+	}
+
+	// Create the HTTP POST request
+	req, err := http.NewRequest("POST", s.serverURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("creating POST request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.apiKey)
+
+	// Send the HTTP POST request
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("POSTing data: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Error("Error closing response body", "error", closeErr)
+		}
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusCreated:
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge ||
+		resp.StatusCode == http.StatusUnprocessableEntity:
+		// The payload itself is bad. Anything else, such as a 401 or a 404
+		// from a proxy while the server is being deployed, is retried.
+		return fmt.Errorf("server returned %s: %w", resp.Status, ErrRejected)
+	default:
+		return fmt.Errorf("server returned non-Created status %s", resp.Status)
+	}
+
+	slog.Info("Successfully POSTed weather data", "payload", payload)
+	return nil
+}
+
+// Close closes any idle connections.
+func (s *HTTPSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+// LineProtocol formats data as InfluxDB line protocol, one measurement per
+// reading, tagged with the transmitter ID and, in decimal, the type of the
+// message it was decoded from:
+//
+//	temperature,transmitter=0,type=8 value=72.5,raw="80 00 00 33 8d 00" 1700000000000000000
+//	humidity,transmitter=0,type=10 value=75.1,raw="a0 05 c0 ef 2b 01" 1700000000000000000
+//
+// A reading without a raw message has no type tag.
+func LineProtocol(data WeatherDatum) []byte {
+	var buf bytes.Buffer
+	for _, r := range readings(data) {
+		buf.WriteString(r.field)
+		fmt.Fprintf(&buf, ",transmitter=%d", r.transmitter)
+		if t, ok := r.messageType(); ok {
+			fmt.Fprintf(&buf, ",type=%d", t)
+		}
+		buf.WriteString(" value=")
+		buf.WriteString(lineValue(r.value))
+		if r.raw != "" {
+			buf.WriteString(`,raw="`)
+			buf.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(r.raw))
+			buf.WriteString(`"`)
+		}
+		fmt.Fprintf(&buf, " %d\n", r.receivedAt.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+// lineValue formats a field value; integers get the i suffix.
+func lineValue(v any) string {
+	switch v := v.(type) {
+	case int16:
+		return strconv.Itoa(int(v)) + "i"
+	case int:
+		return strconv.Itoa(v) + "i"
+	default:
+		return formatValue(v)
+	}
+}
+
+// InfluxHTTPSink writes to the InfluxDB HTTP API: the /api/v2/write URL
+// with org and bucket for InfluxDB 2, or /write with db for InfluxDB 1.
+type InfluxHTTPSink struct {
+	URL   string
+	Token string
+
+	httpClient *http.Client
+}
+
+func NewInfluxHTTPSink(url, token string) *InfluxHTTPSink {
+	return &InfluxHTTPSink{
+		URL:        url,
+		Token:      token,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *InfluxHTTPSink) Name() string {
+	return "influx"
+}
+
+func (s *InfluxHTTPSink) Send(data WeatherDatum) error {
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(LineProtocol(data)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Error("Error closing response body", "error", closeErr)
+		}
+	}()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("influx returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", err, ErrRejected)
+	}
+	return err
+}
+
+func (s *InfluxHTTPSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// maxDatagram keeps UDP datagrams within a typical MTU.
+const maxDatagram = 1400
+
+// InfluxUDPSink sends line protocol to an InfluxDB UDP listener.  Delivery
+// is not confirmed.
+type InfluxUDPSink struct {
+	Addr string
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func NewInfluxUDPSink(addr string) *InfluxUDPSink {
+	return &InfluxUDPSink{Addr: addr}
+}
+
+func (s *InfluxUDPSink) Name() string {
+	return "influx-udp"
+}
+
+func (s *InfluxUDPSink) Send(data WeatherDatum) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.Dial("udp", s.Addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	// Split at line ends, so that every datagram holds whole points.
+	lines := LineProtocol(data)
+	for len(lines) > 0 {
+		n := len(lines)
+		if n > maxDatagram {
+			n = bytes.LastIndexByte(lines[:maxDatagram], '\n') + 1
+			if n == 0 {
+				n = bytes.IndexByte(lines, '\n') + 1
+			}
+		}
+		if _, err := s.conn.Write(lines[:n]); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
+
+func (s *InfluxUDPSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,105 @@
+package processor
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var influxData = WeatherDatum{
+	Temperature: &TemperatureDatum{
+		Value:       72.5,
+		Transmitter: 1,
+		ReceivedAt:  time.Unix(1700000000, 5),
+		RawMessage:  "81 00 00 33 8d 00",
+	},
+	Wind: &WindDatum{
+		Speed:      3,
+		Direction:  180,
+		ReceivedAt: time.Unix(1700000002, 0),
+		RawMessage: "a0 03 80 ef 2b 01",
+	},
+	Signal: &SignalDatum{RSSI: -40.5, SNR: 20, ReceivedAt: time.Unix(1700000002, 0)},
+}
+
+func TestLineProtocol(t *testing.T) {
+	assert.Equal(t, `temperature,transmitter=1,type=8 value=72.5,raw="81 00 00 33 8d 00" 1700000000000000005
+wind_speed,transmitter=0,type=10 value=3i,raw="a0 03 80 ef 2b 01" 1700000002000000000
+wind_direction,transmitter=0,type=10 value=180i,raw="a0 03 80 ef 2b 01" 1700000002000000000
+rssi,transmitter=0 value=-40.5 1700000002000000000
+snr,transmitter=0 value=20 1700000002000000000
+`, string(LineProtocol(influxData)))
+}
+
+func TestLineProtocolMessageType(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	assert.Equal(t, `humidity,transmitter=0,type=10 value=75.1,raw="a0 05 c0 ef 2b 01 37 e6" 1700000000000000000
+rain_clicks,transmitter=0,type=14 value=16i,raw="e0 02 00 10 00 00 00 00" 1700000000000000000
+rssi,transmitter=0,type=14 value=-40.5,raw="e0 02 00 10 00 00 00 00" 1700000000000000000
+snr,transmitter=0,type=14 value=20,raw="e0 02 00 10 00 00 00 00" 1700000000000000000
+`, string(LineProtocol(WeatherDatum{
+		Humidity: &HumidityDatum{Value: 75.1, ReceivedAt: at, RawMessage: "a0 05 c0 ef 2b 01 37 e6"},
+		Rainfall: &RainfallDatum{TotalClicks: 16, ReceivedAt: at, RawMessage: "e0 02 00 10 00 00 00 00"},
+		Signal:   &SignalDatum{RSSI: -40.5, SNR: 20, ReceivedAt: at, RawMessage: "e0 02 00 10 00 00 00 00"},
+	})))
+}
+
+func TestInfluxHTTPSink(t *testing.T) {
+	status := http.StatusNoContent
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "weather", r.URL.Query().Get("bucket"))
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxHTTPSink(server.URL+"/api/v2/write?org=home&bucket=weather", "secret")
+	defer func() { _ = sink.Close() }()
+
+	require.NoError(t, sink.Send(influxData))
+	assert.Equal(t, string(LineProtocol(influxData)), body)
+
+	status = http.StatusBadRequest
+	assert.ErrorIs(t, sink.Send(influxData), ErrRejected)
+	status = http.StatusServiceUnavailable
+	err := sink.Send(influxData)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRejected)
+}
+
+func TestInfluxUDPSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	sink := NewInfluxUDPSink(conn.LocalAddr().String())
+	defer func() { _ = sink.Close() }()
+
+	// Enough readings for more than one datagram.
+	data := influxData
+	data.Temperature = &TemperatureDatum{Value: 72.5, RawMessage: strings.Repeat("8", 1000)}
+	require.NoError(t, sink.Send(data))
+
+	var got string
+	buf := make([]byte, 2048)
+	for strings.Count(got, "\n") < 5 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, n, maxDatagram)
+		assert.True(t, strings.HasSuffix(string(buf[:n]), "\n"), "datagrams hold whole lines")
+		got += string(buf[:n])
+	}
+	assert.Equal(t, string(LineProtocol(data)), got)
+}
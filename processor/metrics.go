@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"strconv"
+
+	"github.com/nathanmsmith/rtldavis/metrics"
+)
+
+// metricNames gives the Prometheus name and help of each reading, by field.
+var metricNames = map[string][2]string{
+	"temperature":     {"rtldavis_temperature_fahrenheit", "Outside temperature in °F."},
+	"humidity":        {"rtldavis_humidity_percent", "Relative humidity in percent."},
+	"wind_speed":      {"rtldavis_wind_speed_mph", "Wind speed in miles per hour."},
+	"wind_direction":  {"rtldavis_wind_direction_degrees", "Wind direction in degrees."},
+	"gust_speed":      {"rtldavis_gust_speed_mph", "Highest wind speed of the last ten minutes reported by the ISS, in miles per hour."},
+	"rain_rate":       {"rtldavis_rain_rate_inches_per_hour", "Rain rate in inches per hour."},
+	"rain_clicks":     {"rtldavis_rain_clicks", "Rain bucket tips, counting up to 127 and wrapping to 0."},
+	"uv_index":        {"rtldavis_uv_index", "UV index."},
+	"solar_radiation": {"rtldavis_solar_radiation_watts_per_square_meter", "Solar radiation in W/m²."},
+	"supercap":        {"rtldavis_supercap_volts", "Supercapacitor voltage."},
+	"battery_low":     {"rtldavis_battery_low", "Whether the transmitter reports a low battery."},
+	"solar_voltage":   {"rtldavis_solar_volts", "Solar panel voltage."},
+	"rssi":            {"rtldavis_rssi_db", "Signal strength of the last packet in dB."},
+	"snr":             {"rtldavis_snr_db", "Signal to noise ratio of the last packet in dB."},
+}
+
+// metricOrder is the order the families are written in.
+var metricOrder = []string{
+	"temperature", "humidity", "wind_speed", "wind_direction", "gust_speed",
+	"rain_rate", "rain_clicks", "uv_index", "solar_radiation", "supercap", "battery_low", "solar_voltage", "rssi", "snr",
+}
+
+// MetricFamilies returns the readings of each transmitter as Prometheus
+// gauges with a transmitter label, and when each transmitter was last
+// heard.
+func MetricFamilies(transmitters map[byte]WeatherDatum) []metrics.Family {
+	byField := make(map[string][]metrics.Sample)
+	var lastSeen [8]float64
+	var all []reading
+	for _, id := range transmitterIDs(transmitters) {
+		all = append(all, readings(transmitters[id])...)
+	}
+	for _, r := range all {
+		tr := metrics.Label{Name: "transmitter", Value: strconv.Itoa(int(r.transmitter))}
+		byField[r.field] = append(byField[r.field], metrics.Sample{
+			Labels: []metrics.Label{tr},
+			Value:  metricValue(r.value),
+		})
+		if t := float64(r.receivedAt.UnixMilli()) / 1000; t > lastSeen[r.transmitter&7] {
+			lastSeen[r.transmitter&7] = t
+		}
+	}
+
+	families := make([]metrics.Family, 0, len(metricOrder)+1)
+	for _, field := range metricOrder {
+		families = append(families, metrics.Family{
+			Name:    metricNames[field][0],
+			Help:    metricNames[field][1],
+			Type:    metrics.Gauge,
+			Samples: byField[field],
+		})
+	}
+	seen := metrics.Family{
+		Name: "rtldavis_last_received_timestamp_seconds",
+		Help: "When a packet of the transmitter was last received, in seconds since the epoch.",
+		Type: metrics.Gauge,
+	}
+	for id, t := range lastSeen {
+		if t > 0 {
+			seen.Samples = append(seen.Samples, metrics.Sample{
+				Labels: []metrics.Label{{Name: "transmitter", Value: strconv.Itoa(id)}},
+				Value:  t,
+			})
+		}
+	}
+	return append(families, seen)
+}
+
+func metricValue(v any) float64 {
+	switch v := v.(type) {
+	case float32:
+		// Go through the shortest decimal so 72.1 does not become 72.09999847.
+		f, _ := strconv.ParseFloat(formatValue(v), 64)
+		return f
+	case float64:
+		return v
+	case int16:
+		return float64(v)
+	case int:
+		return float64(v)
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
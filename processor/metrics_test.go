@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricFamilies(t *testing.T) {
+	// Both transmitters send a temperature and a supercap voltage.
+	iss := influxData
+	iss.Temperature = &TemperatureDatum{Value: 72.1, ReceivedAt: time.Unix(1700000001, 0)}
+	iss.Battery = &BatteryDatum{Voltage: 2.8, ReceivedAt: time.Unix(1700000001, 0)}
+	transmitters := map[byte]WeatherDatum{
+		0: iss,
+		1: {
+			Temperature: influxData.Temperature,
+			Battery:     &BatteryDatum{Voltage: 3.5, IsLow: true, Transmitter: 1, ReceivedAt: influxData.Temperature.ReceivedAt},
+		},
+	}
+
+	var b strings.Builder
+	require.NoError(t, metrics.Write(&b, MetricFamilies(transmitters)))
+	assert.Equal(t, `# HELP rtldavis_temperature_fahrenheit Outside temperature in °F.
+# TYPE rtldavis_temperature_fahrenheit gauge
+rtldavis_temperature_fahrenheit{transmitter="0"} 72.1
+rtldavis_temperature_fahrenheit{transmitter="1"} 72.5
+# HELP rtldavis_wind_speed_mph Wind speed in miles per hour.
+# TYPE rtldavis_wind_speed_mph gauge
+rtldavis_wind_speed_mph{transmitter="0"} 3
+# HELP rtldavis_wind_direction_degrees Wind direction in degrees.
+# TYPE rtldavis_wind_direction_degrees gauge
+rtldavis_wind_direction_degrees{transmitter="0"} 180
+# HELP rtldavis_supercap_volts Supercapacitor voltage.
+# TYPE rtldavis_supercap_volts gauge
+rtldavis_supercap_volts{transmitter="0"} 2.8
+rtldavis_supercap_volts{transmitter="1"} 3.5
+# HELP rtldavis_battery_low Whether the transmitter reports a low battery.
+# TYPE rtldavis_battery_low gauge
+rtldavis_battery_low{transmitter="0"} 0
+rtldavis_battery_low{transmitter="1"} 1
+# HELP rtldavis_rssi_db Signal strength of the last packet in dB.
+# TYPE rtldavis_rssi_db gauge
+rtldavis_rssi_db{transmitter="0"} -40.5
+# HELP rtldavis_snr_db Signal to noise ratio of the last packet in dB.
+# TYPE rtldavis_snr_db gauge
+rtldavis_snr_db{transmitter="0"} 20
+# HELP rtldavis_last_received_timestamp_seconds When a packet of the transmitter was last received, in seconds since the epoch.
+# TYPE rtldavis_last_received_timestamp_seconds gauge
+rtldavis_last_received_timestamp_seconds{transmitter="0"} 1.700000002e+09
+rtldavis_last_received_timestamp_seconds{transmitter="1"} 1.7e+09
+`, b.String())
+}
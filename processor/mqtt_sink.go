@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"log/slog"
+
+	"github.com/nathanmsmith/rtldavis/mqtt"
+)
+
+// MQTTSink publishes every reading to its own topic under
+// Prefix/<transmitter ID>/, such as rtldavis/0/temperature, and all the
+// readings of a transmitter as JSON to Prefix/<transmitter ID>/state.
+type MQTTSink struct {
+	Addr    string
+	Options mqtt.Options
+	Prefix  string
+	QoS     byte
+	Retain  bool
+
+	// With a DiscoveryPrefix, Devices are announced to Home Assistant
+	// every time the sink connects.
+	DiscoveryPrefix string
+	Devices         []HADevice
+
+	mutex  sync.Mutex
+	client *mqtt.Client
+	// The latest readings of every transmitter, for the state topic.
+	state map[byte]map[string]any
+}
+
+func NewMQTTSink(addr string, opts mqtt.Options, prefix string, qos byte, retain bool) *MQTTSink {
+	return &MQTTSink{
+		Addr:    addr,
+		Options: opts,
+		Prefix:  prefix,
+		QoS:     qos,
+		Retain:  retain,
+		state:   make(map[byte]map[string]any),
+	}
+}
+
+func (s *MQTTSink) Name() string {
+	return "mqtt"
+}
+
+// Topic returns the topic of a transmitter's field.
+func (s *MQTTSink) Topic(transmitter byte, field string) string {
+	return fmt.Sprintf("%s/%d/%s", s.Prefix, transmitter, field)
+}
+
+func (s *MQTTSink) Send(data WeatherDatum) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client == nil {
+		client, err := mqtt.Dial(s.Addr, s.Options)
+		if err != nil {
+			return err
+		}
+		slog.Info("Connected to MQTT broker", "address", s.Addr)
+		s.client = client
+		if s.DiscoveryPrefix != "" {
+			if err := s.announce(); err != nil {
+				return err
+			}
+		}
+	}
+
+	changed := make(map[byte]bool)
+	for _, r := range readings(data) {
+		if err := s.publish(s.Topic(r.transmitter, r.field), []byte(formatValue(r.value))); err != nil {
+			return err
+		}
+		if s.state[r.transmitter] == nil {
+			s.state[r.transmitter] = make(map[string]any)
+		}
+		s.state[r.transmitter][r.field] = r.value
+		changed[r.transmitter] = true
+	}
+	for id := range changed {
+		state := s.state[id]
+		state["sent_at"] = data.SentAt
+		payload, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err := s.publish(s.Topic(id, "state"), payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish drops the connection if it fails, to reconnect on the next Send.
+func (s *MQTTSink) publish(topic string, payload []byte) error {
+	err := s.client.Publish(topic, payload, s.QoS, s.Retain)
+	if err != nil {
+		_ = s.client.Close()
+		s.client = nil
+	}
+	return err
+}
+
+func (s *MQTTSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
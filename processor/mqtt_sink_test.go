@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/mqtt"
+	"github.com/nathanmsmith/rtldavis/mqtt/mqtttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQTTSink(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = broker.Close() }()
+
+	sink := NewMQTTSink(broker.Addr, mqtt.Options{ClientID: "test"}, "davis", 1, true)
+	defer func() { _ = sink.Close() }()
+
+	require.NoError(t, sink.Send(WeatherDatum{
+		Temperature: &TemperatureDatum{Value: 72.5},
+		Wind:        &WindDatum{Speed: 3, Direction: 180},
+		Battery:     &BatteryDatum{Voltage: 2.8, IsLow: true},
+	}))
+	require.NoError(t, sink.Send(WeatherDatum{
+		Humidity: &HumidityDatum{Value: 55, Transmitter: 2},
+	}))
+
+	retained := broker.Retained()
+	payloads := make(map[string]string)
+	for topic, m := range retained {
+		payloads[topic] = string(m.Payload)
+		assert.Equal(t, byte(1), m.QoS)
+	}
+	assert.Equal(t, "72.5", payloads["davis/0/temperature"])
+	assert.Equal(t, "3", payloads["davis/0/wind_speed"])
+	assert.Equal(t, "180", payloads["davis/0/wind_direction"])
+	assert.Equal(t, "2.8", payloads["davis/0/supercap"])
+	assert.Equal(t, "true", payloads["davis/0/battery_low"])
+	assert.Equal(t, "55", payloads["davis/2/humidity"])
+	assert.NotContains(t, payloads, "davis/2/temperature")
+
+	var state map[string]any
+	require.NoError(t, json.Unmarshal(retained["davis/0/state"].Payload, &state))
+	assert.Equal(t, 72.5, state["temperature"])
+	assert.Equal(t, 180.0, state["wind_direction"])
+	require.NoError(t, json.Unmarshal(retained["davis/2/state"].Payload, &state))
+	assert.Equal(t, 55.0, state["humidity"])
+}
+
+func TestMQTTSinkWithTwoTransmitters(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = broker.Close() }()
+
+	wp := NewWeatherProcessor(10)
+	twoTransmitters(t, wp)
+	wp.AddTransmitterSink(NewMQTTSink(broker.Addr, mqtt.Options{ClientID: "test"}, "davis", 1, true), time.Hour)
+	wp.Stop()
+
+	retained := broker.Retained()
+	assert.Equal(t, "82.4", string(retained["davis/0/temperature"].Payload))
+	assert.Equal(t, "40.8", string(retained["davis/1/temperature"].Payload))
+	assert.Equal(t, "false", string(retained["davis/0/battery_low"].Payload))
+	assert.Equal(t, "true", string(retained["davis/1/battery_low"].Payload))
+	for _, id := range []string{"0", "1"} {
+		var state map[string]any
+		require.NoError(t, json.Unmarshal(retained["davis/"+id+"/state"].Payload, &state))
+		assert.Contains(t, state, "temperature", id)
+		assert.Contains(t, state, "supercap", id)
+	}
+}
+
+func TestMQTTSinkReconnects(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = broker.Close() }()
+
+	sink := NewMQTTSink(broker.Addr, mqtt.Options{ClientID: "test", Timeout: time.Second}, "davis", 1, false)
+	defer func() { _ = sink.Close() }()
+
+	data := WeatherDatum{Temperature: &TemperatureDatum{Value: 72.5}}
+	require.NoError(t, sink.Send(data))
+	broker.DropClients()
+	assert.Error(t, sink.Send(data), "the broker went away")
+	require.NoError(t, sink.Send(data), "connects again")
+	assert.Len(t, broker.Connects(), 2)
+}
+
+func TestHomeAssistantDiscovery(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	require.NoError(t, err)
+	defer func() { _ = broker.Close() }()
+
+	sink := NewMQTTSink(broker.Addr, mqtt.Options{ClientID: "rtldavis", Timeout: time.Second}, "davis", 1, false)
+	sink.DiscoveryPrefix = "homeassistant"
+	sink.Devices = []HADevice{
+		{ID: 0, Name: "ISS", Model: "Vantage Vue ISS", Sensors: []string{"temperature", "rain_rate", "battery_low"}},
+		{ID: 2, Model: "Wireless Temperature Station", Sensors: []string{"temperature"}},
+	}
+	defer func() { _ = sink.Close() }()
+
+	require.NoError(t, sink.Send(WeatherDatum{Temperature: &TemperatureDatum{Value: 72.5}}))
+	retained := broker.Retained()
+	assert.Len(t, retained, 4, "discovery configs are retained, readings are not")
+
+	config := func(topic string) map[string]any {
+		m, ok := retained[topic]
+		require.True(t, ok, topic)
+		var c map[string]any
+		require.NoError(t, json.Unmarshal(m.Payload, &c))
+		return c
+	}
+
+	temp := config("homeassistant/sensor/rtldavis_0/temperature/config")
+	assert.Equal(t, "Temperature", temp["name"])
+	assert.Equal(t, "rtldavis_0_temperature", temp["unique_id"])
+	assert.Equal(t, "davis/0/temperature", temp["state_topic"])
+	assert.Equal(t, "temperature", temp["device_class"])
+	assert.Equal(t, "°F", temp["unit_of_measurement"])
+	assert.Equal(t, "measurement", temp["state_class"])
+	device := temp["device"].(map[string]any)
+	assert.Equal(t, "ISS", device["name"])
+	assert.Equal(t, []any{"rtldavis_0"}, device["identifiers"])
+	assert.Equal(t, "Davis Instruments", device["manufacturer"])
+
+	rain := config("homeassistant/sensor/rtldavis_0/rain_rate/config")
+	assert.Equal(t, "precipitation_intensity", rain["device_class"])
+	assert.Equal(t, "in/h", rain["unit_of_measurement"])
+
+	battery := config("homeassistant/binary_sensor/rtldavis_0/battery_low/config")
+	assert.Equal(t, "battery", battery["device_class"])
+	assert.Equal(t, "true", battery["payload_on"])
+	assert.Equal(t, "diagnostic", battery["entity_category"])
+
+	other := config("homeassistant/sensor/rtldavis_2/temperature/config")
+	assert.Equal(t, "Davis transmitter 2", other["device"].(map[string]any)["name"])
+
+	// Discovery comes before the readings, and again after reconnecting.
+	assert.Equal(t, "davis/0/temperature", broker.Messages()[4].Topic)
+	broker.DropClients()
+	require.Error(t, sink.Send(WeatherDatum{Temperature: &TemperatureDatum{Value: 72.5}}))
+	require.NoError(t, sink.Send(WeatherDatum{Temperature: &TemperatureDatum{Value: 72.5}}))
+	assert.Len(t, broker.Messages(), 4+2+4+2)
+}
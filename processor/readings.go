@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// reading is one field of a transmitter, named as the MQTT topics and the
+// InfluxDB measurements.
+type reading struct {
+	transmitter byte
+	field       string
+	value       any
+	raw         string // the message it was decoded from, if any
+	receivedAt  time.Time
+}
+
+// messageType returns the type of the message the reading was decoded
+// from, or false if it has no raw message.
+func (r reading) messageType() (byte, bool) {
+	data, err := hex.DecodeString(strings.ReplaceAll(r.raw, " ", ""))
+	if err != nil || len(data) == 0 {
+		return 0, false
+	}
+	return GetMessageType(protocol.Message{Packet: dsp.Packet{Data: data}}), true
+}
+
+// readings returns the fields of data by transmitter.
+func readings(data WeatherDatum) (r []reading) {
+	if d := data.Temperature; d != nil {
+		r = append(r, reading{d.Transmitter, "temperature", d.Value, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Humidity; d != nil {
+		r = append(r, reading{d.Transmitter, "humidity", d.Value, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Wind; d != nil {
+		r = append(r, reading{d.Transmitter, "wind_speed", d.Speed, d.RawMessage, d.ReceivedAt},
+			reading{d.Transmitter, "wind_direction", d.Direction, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Gust; d != nil {
+		r = append(r, reading{d.Transmitter, "gust_speed", d.Speed, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.RainRate; d != nil {
+		r = append(r, reading{d.Transmitter, "rain_rate", d.InchesPerHour, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Rainfall; d != nil {
+		r = append(r, reading{d.Transmitter, "rain_clicks", d.TotalClicks, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.UV; d != nil {
+		r = append(r, reading{d.Transmitter, "uv_index", d.Value, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.SolarRadiation; d != nil {
+		r = append(r, reading{d.Transmitter, "solar_radiation", d.Value, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Battery; d != nil {
+		r = append(r, reading{d.Transmitter, "supercap", d.Voltage, d.RawMessage, d.ReceivedAt},
+			reading{d.Transmitter, "battery_low", d.IsLow, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Solar; d != nil {
+		r = append(r, reading{d.Transmitter, "solar_voltage", d.Voltage, d.RawMessage, d.ReceivedAt})
+	}
+	if d := data.Signal; d != nil {
+		r = append(r, reading{d.Transmitter, "rssi", d.RSSI, d.RawMessage, d.ReceivedAt},
+			reading{d.Transmitter, "snr", d.SNR, d.RawMessage, d.ReceivedAt})
+	}
+	return r
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
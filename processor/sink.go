@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"io"
+	"slices"
+	"time"
+
+	"log/slog"
+)
+
+// Sink is a destination for the weather data.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Send delivers the readings received since the last successful Send.
+	// The readings are sent again, merged with newer ones, if it fails.
+	Send(data WeatherDatum) error
+}
+
+// ReadySink is implemented by sinks that only want data holding certain
+// readings.  Other sinks get any data that isn't empty.
+type ReadySink interface {
+	Ready(data WeatherDatum) bool
+}
+
+// AddSink sends the weather data to sink every interval, and once more
+// when the processor stops.  Sinks implementing io.Closer are closed then.
+func (wp *WeatherProcessor) AddSink(sink Sink, interval time.Duration) {
+	wp.sinks.Add(1)
+	go func() {
+		defer wp.sinks.Done()
+		// The data as of the last successful Send.
+		var sent WeatherDatum
+		wp.runSink(sink, interval, func() { wp.send(sink, wp.Latest(), &sent) })
+	}()
+}
+
+// AddTransmitterSink is AddSink for sinks that keep transmitters apart,
+// such as the MQTT topics of each transmitter.  They get the new readings
+// of each transmitter in a Send of its own, so that a reading of one
+// transmitter never hides the same reading of another.
+func (wp *WeatherProcessor) AddTransmitterSink(sink Sink, interval time.Duration) {
+	wp.sinks.Add(1)
+	go func() {
+		defer wp.sinks.Done()
+		sent := make(map[byte]WeatherDatum)
+		wp.runSink(sink, interval, func() { wp.sendTransmitters(sink, sent) })
+	}()
+}
+
+func (wp *WeatherProcessor) runSink(sink Sink, interval time.Duration, send func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			send()
+		case <-wp.done:
+			send()
+			if c, ok := sink.(io.Closer); ok {
+				if err := c.Close(); err != nil {
+					slog.Error("Error closing sink", "sink", sink.Name(), "error", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// send sends the readings of latest that sink hasn't got yet, and
+// reports whether it didn't fail.
+func (wp *WeatherProcessor) send(sink Sink, latest WeatherDatum, sent *WeatherDatum) bool {
+	data := newReadings(latest, *sent)
+	if r, ok := sink.(ReadySink); ok {
+		if !r.Ready(data) {
+			return true
+		}
+	} else if data.empty() {
+		return true
+	}
+
+	data.SentAt = time.Now()
+	if err := sink.Send(data); err != nil {
+		slog.Error("Error sending weather data", "sink", sink.Name(), "error", err)
+		return false
+	}
+	*sent = latest
+	return true
+}
+
+// sendTransmitters sends the new readings of each transmitter on its own,
+// in ID order, until one fails.
+func (wp *WeatherProcessor) sendTransmitters(sink Sink, sent map[byte]WeatherDatum) {
+	latest := wp.LatestByTransmitter()
+	for _, id := range transmitterIDs(latest) {
+		s := sent[id]
+		if !wp.send(sink, latest[id], &s) {
+			return
+		}
+		sent[id] = s
+	}
+}
+
+// transmitterIDs returns the IDs in transmitters in order.
+func transmitterIDs(transmitters map[byte]WeatherDatum) []byte {
+	ids := make([]byte, 0, len(transmitters))
+	for id := range transmitters {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// newReadings returns the readings of latest that aren't in sent.  Every
+// reading is a new datum, so comparing pointers is enough.
+func newReadings(latest, sent WeatherDatum) (data WeatherDatum) {
+	if latest.Temperature != sent.Temperature {
+		data.Temperature = latest.Temperature
+	}
+	if latest.Wind != sent.Wind {
+		data.Wind = latest.Wind
+	}
+	if latest.Gust != sent.Gust {
+		data.Gust = latest.Gust
+	}
+	if latest.RainRate != sent.RainRate {
+		data.RainRate = latest.RainRate
+	}
+	if latest.Rainfall != sent.Rainfall {
+		data.Rainfall = latest.Rainfall
+	}
+	if latest.Humidity != sent.Humidity {
+		data.Humidity = latest.Humidity
+	}
+	if latest.UV != sent.UV {
+		data.UV = latest.UV
+	}
+	if latest.SolarRadiation != sent.SolarRadiation {
+		data.SolarRadiation = latest.SolarRadiation
+	}
+	if latest.Battery != sent.Battery {
+		data.Battery = latest.Battery
+	}
+	if latest.Solar != sent.Solar {
+		data.Solar = latest.Solar
+	}
+	if latest.Signal != sent.Signal {
+		data.Signal = latest.Signal
+	}
+	if latest.DewPoint != sent.DewPoint {
+		data.DewPoint = latest.DewPoint
+	}
+	if latest.RainTotals != sent.RainTotals {
+		data.RainTotals = latest.RainTotals
+	}
+	if latest.PeakWind != sent.PeakWind {
+		data.PeakWind = latest.PeakWind
+	}
+	return data
+}
+
+func (d WeatherDatum) empty() bool {
+	return d.Temperature == nil && d.Wind == nil && d.Gust == nil && d.RainRate == nil && d.Rainfall == nil &&
+		d.Humidity == nil && d.UV == nil && d.SolarRadiation == nil && d.Battery == nil && d.Solar == nil && d.Signal == nil &&
+		d.DewPoint == nil && d.RainTotals == nil && d.PeakWind == nil
+}
+
+// merge returns base with the readings in data.
+func merge(base, data WeatherDatum) WeatherDatum {
+	if data.Temperature != nil {
+		base.Temperature = data.Temperature
+	}
+	if data.Wind != nil {
+		base.Wind = data.Wind
+	}
+	if data.Gust != nil {
+		base.Gust = data.Gust
+	}
+	if data.RainRate != nil {
+		base.RainRate = data.RainRate
+	}
+	if data.Rainfall != nil {
+		base.Rainfall = data.Rainfall
+	}
+	if data.Humidity != nil {
+		base.Humidity = data.Humidity
+	}
+	if data.UV != nil {
+		base.UV = data.UV
+	}
+	if data.SolarRadiation != nil {
+		base.SolarRadiation = data.SolarRadiation
+	}
+	if data.Battery != nil {
+		base.Battery = data.Battery
+	}
+	if data.Solar != nil {
+		base.Solar = data.Solar
+	}
+	if data.Signal != nil {
+		base.Signal = data.Signal
+	}
+	if data.DewPoint != nil {
+		base.DewPoint = data.DewPoint
+	}
+	if data.RainTotals != nil {
+		base.RainTotals = data.RainTotals
+	}
+	if data.PeakWind != nil {
+		base.PeakWind = data.PeakWind
+	}
+	return base
+}
@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSink records what it is sent and fails while fail is set.
+type fakeSink struct {
+	mutex sync.Mutex
+	sent  []WeatherDatum
+	fail  bool
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Send(data WeatherDatum) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.sent = append(s.sent, data)
+	return nil
+}
+
+func (s *fakeSink) received() []WeatherDatum {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]WeatherDatum(nil), s.sent...)
+}
+
+func (s *fakeSink) setFail(fail bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.fail = fail
+}
+
+// process feeds data and waits until the processor has handled the last.
+func process(t *testing.T, wp *WeatherProcessor, data ...[]byte) {
+	for _, d := range data {
+		wp.AddMessage(createMessage(d))
+	}
+	last := bytesToSpacedHex(data[len(data)-1])
+	require.Eventually(t, func() bool {
+		wind := wp.Latest().Wind
+		return wind != nil && wind.RawMessage == last
+	}, time.Second, time.Millisecond)
+}
+
+var (
+	temperatureMsg = []byte{0x80, 0x00, 0x00, 0x33, 0x8D, 0x00, 0x25, 0x11}
+	humidityMsg    = []byte{0xA0, 0x05, 0xC0, 0xEF, 0x2B, 0x01, 0x37, 0xE6}
+)
+
+func TestSinkGetsOnlyNewReadings(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	sink := &fakeSink{}
+	wp.AddSink(sink, 20*time.Millisecond)
+
+	process(t, wp, temperatureMsg)
+	require.Eventually(t, func() bool { return len(sink.received()) == 1 }, time.Second, time.Millisecond)
+	first := sink.received()[0]
+	assert.NotNil(t, first.Temperature)
+	assert.NotNil(t, first.Wind)
+	assert.False(t, first.SentAt.IsZero())
+
+	process(t, wp, humidityMsg)
+	require.Eventually(t, func() bool { return len(sink.received()) == 2 }, time.Second, time.Millisecond)
+	second := sink.received()[1]
+	assert.Nil(t, second.Temperature, "the temperature was sent before")
+	assert.NotNil(t, second.Humidity)
+
+	// Nothing new: nothing is sent.
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, sink.received(), 2)
+
+	wp.Stop()
+	assert.NotNil(t, wp.Latest().Temperature, "the latest readings are kept")
+}
+
+func TestSinkRetriesAfterFailure(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	sink := &fakeSink{fail: true}
+	wp.AddSink(sink, 10*time.Millisecond)
+
+	process(t, wp, temperatureMsg)
+	process(t, wp, humidityMsg)
+	time.Sleep(30 * time.Millisecond)
+	sink.setFail(false)
+
+	require.Eventually(t, func() bool { return len(sink.received()) == 1 }, time.Second, time.Millisecond)
+	data := sink.received()[0]
+	assert.NotNil(t, data.Temperature, "readings from before the failure are kept")
+	assert.NotNil(t, data.Humidity)
+	wp.Stop()
+}
+
+func TestSinksRunIndependently(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	fast, slow := &fakeSink{}, &fakeSink{}
+	wp.AddSink(fast, 10*time.Millisecond)
+	wp.AddSink(slow, time.Hour)
+
+	process(t, wp, temperatureMsg)
+	require.Eventually(t, func() bool { return len(fast.received()) == 1 }, time.Second, time.Millisecond)
+	assert.Empty(t, slow.received())
+
+	// Stopping flushes the slow sink.
+	wp.Stop()
+	require.Len(t, slow.received(), 1)
+	assert.NotNil(t, slow.received()[0].Temperature)
+}
+
+// twoTransmitters feeds a temperature and a supercap voltage from both
+// transmitter 0 and 1, and waits until they are processed.
+func twoTransmitters(t *testing.T, wp *WeatherProcessor) {
+	for _, m := range []struct {
+		id   byte
+		data []byte
+	}{
+		{0, temperatureMsg},
+		{0, []byte{0x20, 0x00, 0x00, 0xE1, 0x00, 0x00, 0x00, 0x00}},
+		{1, []byte{0x81, 0x01, 0xa2, 0x19, 0x89, 0x04, 0x45, 0x19}},
+		{1, []byte{0x29, 0x00, 0x00, 0xC1, 0x00, 0x00, 0x00, 0x00}},
+	} {
+		message := createMessage(m.data)
+		message.ID = m.id
+		message.BatteryLow = m.data[0]&0x08 != 0
+		wp.AddMessage(message)
+	}
+	require.Eventually(t, func() bool {
+		return wp.LatestByTransmitter()[1].Battery != nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestTransmitterSinkKeepsTransmittersApart(t *testing.T) {
+	wp := NewWeatherProcessor(10)
+	twoTransmitters(t, wp)
+	assert.Equal(t, byte(1), wp.Latest().Temperature.Transmitter, "one slot for the station")
+
+	sink := &fakeSink{}
+	wp.AddTransmitterSink(sink, time.Hour)
+	wp.Stop()
+
+	sent := sink.received()
+	require.Len(t, sent, 2, "one Send per transmitter")
+	for id, data := range sent {
+		require.NotNil(t, data.Temperature)
+		require.NotNil(t, data.Battery)
+		assert.Equal(t, byte(id), data.Temperature.Transmitter)
+		assert.Equal(t, byte(id), data.Battery.Transmitter)
+	}
+	assert.Equal(t, float32(82.4), sent[0].Temperature.Value)
+	assert.Equal(t, float32(40.8), sent[1].Temperature.Value)
+	assert.True(t, sent[1].Battery.IsLow)
+}
+
+func TestStopDecodesQueuedMessages(t *testing.T) {
+	const n = 8
+	wp := NewWeatherProcessor(n)
+	sink := &fakeSink{}
+	wp.AddTransmitterSink(sink, time.Hour)
+
+	for id := byte(0); id < n; id++ {
+		message := createMessage(temperatureMsg)
+		message.ID = id
+		wp.AddMessage(message)
+	}
+	wp.Stop()
+
+	sent := sink.received()
+	require.Len(t, sent, n, "every queued message reaches the sink")
+	for id, data := range sent {
+		require.NotNil(t, data.Temperature)
+		assert.Equal(t, byte(id), data.Temperature.Transmitter)
+	}
+
+	wp.AddMessage(createMessage(temperatureMsg)) // doesn't block
+	wp.Stop()
+	assert.Len(t, sink.received(), n)
+}
+
+func TestHTTPSink(t *testing.T) {
+	status := http.StatusCreated
+	var got WeatherDatum
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "secret", r.Header.Get("x-api-key"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, "secret")
+	defer func() { _ = sink.Close() }()
+
+	assert.False(t, sink.Ready(WeatherDatum{Wind: &WindDatum{}}))
+	data := WeatherDatum{Temperature: &TemperatureDatum{Value: 72.5}}
+	assert.True(t, sink.Ready(data))
+
+	require.NoError(t, sink.Send(data))
+	require.NotNil(t, got.Temperature)
+	assert.Equal(t, float32(72.5), got.Temperature.Value)
+
+	status = http.StatusOK
+	assert.Error(t, sink.Send(data), "anything but 201 is a failure")
+	for _, status = range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity} {
+		assert.ErrorIs(t, sink.Send(data), ErrRejected, status)
+	}
+	for _, status = range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+		http.StatusTooManyRequests, http.StatusBadGateway} {
+		err := sink.Send(data)
+		assert.Error(t, err, status)
+		assert.NotErrorIs(t, err, ErrRejected, status)
+	}
+}
@@ -1,9 +1,6 @@
 package processor
 
 import (
-	"bytes"
-	"encoding/json"
-	"net/http"
 	"sync"
 	"time"
 
@@ -13,330 +10,389 @@ import (
 )
 
 type WindDatum struct {
-	Speed      int16     `json:"speed"`
-	Direction  int16     `json:"direction"`
-	ReceivedAt time.Time `json:"received_at"`
-	RawMessage string    `json:"raw_message"`
+	Speed       int16     `json:"speed"`
+	Direction   int16     `json:"direction"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
+}
+
+// GustDatum is the highest wind speed of the last ten minutes in mph as
+// the ISS reports it.
+type GustDatum struct {
+	Speed       int16     `json:"speed"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
 }
 
 type TemperatureDatum struct {
-	Value      float32   `json:"value"`
-	ReceivedAt time.Time `json:"received_at"`
-	RawMessage string    `json:"raw_message"`
+	Value       float32   `json:"value"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
 }
 
 type HumidityDatum struct {
-	Value      float32   `json:"value"`
-	ReceivedAt time.Time `json:"received_at"`
-	RawMessage string    `json:"raw_message"`
+	Value       float32        `json:"value"`
+	Sensor      HumiditySensor `json:"sensor"`
+	Transmitter byte           `json:"transmitter"`
+	ReceivedAt  time.Time      `json:"received_at"`
+	RawMessage  string         `json:"raw_message"`
 }
 
 type RainRateDatum struct {
 	InchesPerHour float32   `json:"inches_per_hour"`
+	Transmitter   byte      `json:"transmitter"`
 	ReceivedAt    time.Time `json:"received_at"`
 	RawMessage    string    `json:"raw_message"`
 }
 
 type RainfallDatum struct {
 	TotalClicks int16     `json:"total_clicks"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
+}
+
+type UVDatum struct {
+	Value       float32   `json:"value"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
+}
+
+type SolarRadiationDatum struct {
+	Value       float32   `json:"value"`
+	Transmitter byte      `json:"transmitter"`
 	ReceivedAt  time.Time `json:"received_at"`
 	RawMessage  string    `json:"raw_message"`
 }
 
 type BatteryDatum struct {
-	Voltage    float32   `json:"voltage"`
-	IsLow      bool      `json:"is_low"`
-	ReceivedAt time.Time `json:"received_at"`
-	RawMessage string    `json:"raw_message"`
+	Voltage     float32   `json:"voltage"`
+	IsLow       bool      `json:"is_low"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
 }
 
 type SolarDatum struct {
-	Voltage    float32   `json:"voltage"`
-	ReceivedAt time.Time `json:"received_at"`
-	RawMessage string    `json:"raw_message"`
+	Voltage     float32   `json:"voltage"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
+}
+
+// SignalDatum is the reception quality of the last packet, in dBFS for
+// RSSI and Noise and dB for SNR.  Repaired counts the bits the checksum
+// repair flipped.
+type SignalDatum struct {
+	RSSI        float64   `json:"rssi"`
+	Noise       float64   `json:"noise"`
+	SNR         float64   `json:"snr"`
+	Repaired    int       `json:"repaired"`
+	Transmitter byte      `json:"transmitter"`
+	ReceivedAt  time.Time `json:"received_at"`
+	RawMessage  string    `json:"raw_message"`
 }
 
 type WeatherDatum struct {
 	Temperature *TemperatureDatum `json:"temperature"`
 	Wind        *WindDatum        `json:"wind"`
+	Gust        *GustDatum        `json:"gust"`
 	RainRate    *RainRateDatum    `json:"rain_rate"`
 	Rainfall    *RainfallDatum    `json:"rainfall"`
 	Humidity    *HumidityDatum    `json:"humidity"`
+	UV          *UVDatum          `json:"uv"`
+
+	SolarRadiation *SolarRadiationDatum `json:"solar_radiation"`
 
 	Battery *BatteryDatum `json:"battery"`
 	Solar   *SolarDatum   `json:"solar"`
 
+	Signal *SignalDatum `json:"signal"`
+
+	// Computed from several readings
+	DewPoint   *DewPointDatum   `json:"dew_point"`
+	RainTotals *RainTotalsDatum `json:"rain_totals"`
+	PeakWind   *PeakWindDatum   `json:"peak_wind"`
+
 	SentAt time.Time `json:"sent_at"`
 }
 
-// POSTs weather data to a server every N seconds
-// or when all data is collected.
+// WeatherProcessor decodes messages into the latest weather data and hands
+// it to its sinks, each on its own interval.
 type WeatherProcessor struct {
-	data        WeatherDatum
+	data        WeatherDatum // latest reading of every sensor
 	mutex       sync.Mutex
 	batchSize   int
-	interval    time.Duration
-	serverURL   string
-	apiKey      string
 	messageChan chan protocol.Message
-	done        chan struct{}
-	httpClient  *http.Client
+	done        chan struct{} // closed once the queued messages are decoded
+	sinks       sync.WaitGroup
+
+	// intake guards sending on messageChan against Stop closing it.
+	intake  sync.RWMutex
+	stopped bool
+
+	// The latest readings of each transmitter, which data mixes up when
+	// several send the same readings.
+	transmitters map[byte]WeatherDatum
+
+	// The rain bucket counter and peak wind window of each transmitter.
+	rain     map[byte]*rainCounter
+	peakWind map[byte]*peakWind
 }
 
-func NewWeatherProcessor(serverURL string, apiKey string, interval time.Duration, batchSize int) *WeatherProcessor {
-	bp := &WeatherProcessor{
+func NewWeatherProcessor(batchSize int) *WeatherProcessor {
+	wp := &WeatherProcessor{
 		batchSize:   batchSize,
-		interval:    interval,
-		serverURL:   serverURL,
-		apiKey:      apiKey,
 		messageChan: make(chan protocol.Message, batchSize),
 		done:        make(chan struct{}),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:          100,
-				MaxIdleConnsPerHost:   10,
-				MaxConnsPerHost:       10,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				ForceAttemptHTTP2:     true,
-			},
-		},
+
+		transmitters: make(map[byte]WeatherDatum),
+		rain:         make(map[byte]*rainCounter),
+		peakWind:     make(map[byte]*peakWind),
 	}
 
 	// Start the background processing
-	go bp.processMessages()
-	go bp.sendDataPeriodically()
+	go wp.processMessages()
 
-	return bp
+	return wp
 }
 
-func (wp *WeatherProcessor) hasSomeDataFields() bool {
-	return wp.data.Temperature != nil
+// Latest returns the latest reading of every sensor.
+func (wp *WeatherProcessor) Latest() WeatherDatum {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+
+	return wp.data
 }
 
-// func (wp *WeatherProcessor) hasAllDataFields() bool {
-// 	return wp.data.Temperature != nil
-// }
+// LatestByTransmitter returns the latest readings of each transmitter
+// heard, by ID.
+func (wp *WeatherProcessor) LatestByTransmitter() map[byte]WeatherDatum {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+
+	latest := make(map[byte]WeatherDatum, len(wp.transmitters))
+	for id, data := range wp.transmitters {
+		latest[id] = data
+	}
+	return latest
+}
 
+// processMessages decodes the messages until Stop closes messageChan, and
+// then tells the sinks to send what is left.
 func (wp *WeatherProcessor) processMessages() {
-	for {
-		select {
-		case message := <-wp.messageChan:
-			wp.mutex.Lock()
-
-			slog.Info("Processing message", "raw_message", bytesToSpacedHex(message.Data))
-
-			windSpeed := DecodeWindSpeed(message)
-			windDirection := DecodeWindDirection(message)
-			wp.data.Wind = &WindDatum{
-				Speed:      windSpeed,
-				Direction:  windDirection,
-				ReceivedAt: message.ReceivedAt,
-				RawMessage: bytesToSpacedHex(message.Data),
-			}
-			slog.Info("Saved wind data, will send soon", "windspeed", windSpeed, "direction", windDirection)
-
-			switch GetMessageType(message) {
-
-			// Super capacitor voltage
-			case 0x02:
-				voltage, err := DecodeSupercap(message)
-				if err == nil {
-					wp.data.Battery = &BatteryDatum{
-						Voltage:    voltage,
-						IsLow:      message.BatteryLow,
-						ReceivedAt: message.ReceivedAt,
-						RawMessage: bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved super capacitor data, will send soon", "voltage", voltage, "battery_low", message.BatteryLow)
-				} else {
-					slog.Error("Could not decode temperature from packet", "error", err)
-				}
+	defer close(wp.done)
+
+	for message := range wp.messageChan {
+		wp.mutex.Lock()
+		before := wp.data
+
+		slog.Info("Processing message", "raw_message", bytesToSpacedHex(message.Data),
+			"rssi", round1(message.RSSI), "snr", round1(message.SNR), "repaired", message.Repaired)
+
+		wp.data.Signal = &SignalDatum{
+			RSSI:        round1(message.RSSI),
+			Noise:       round1(message.Noise),
+			SNR:         round1(message.SNR),
+			Repaired:    message.Repaired,
+			ReceivedAt:  message.ReceivedAt,
+			Transmitter: message.ID,
+			RawMessage:  bytesToSpacedHex(message.Data),
+		}
 
-			// UV Index
-			// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-4-uv-index
-			case 0x04:
-				slog.Error("Detected a UV Index reading. This is unexpected!!")
-
-			// Rain Rate
-			case 0x05:
-				inchesPerHour, err := DecodeRainRate(message)
-				if err == nil {
-					wp.data.RainRate = &RainRateDatum{
-						InchesPerHour: inchesPerHour,
-						ReceivedAt:    message.ReceivedAt,
-						RawMessage:    bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved rain rate data, will send soon", "inchesPerHour", inchesPerHour)
-				} else {
-					slog.Error("Could not decode temperature from packet", "error", err)
+		windSpeed := DecodeWindSpeed(message)
+		windDirection := DecodeWindDirection(message)
+		wp.data.Wind = &WindDatum{
+			Speed:       windSpeed,
+			Direction:   windDirection,
+			ReceivedAt:  message.ReceivedAt,
+			Transmitter: message.ID,
+			RawMessage:  bytesToSpacedHex(message.Data),
+		}
+		slog.Info("Saved wind data, will send soon", "windspeed", windSpeed, "direction", windDirection)
+
+		switch GetMessageType(message) {
+
+		// Super capacitor voltage
+		case 0x02:
+			voltage, err := DecodeSupercap(message)
+			if err == nil {
+				wp.data.Battery = &BatteryDatum{
+					Voltage:     voltage,
+					IsLow:       message.BatteryLow,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
 				}
+				slog.Info("Saved super capacitor data, will send soon", "voltage", voltage, "battery_low", message.BatteryLow)
+			} else {
+				slog.Error("Could not decode temperature from packet", "error", err)
+			}
 
-			case 0x06:
-				slog.Error("Detected a solar radiation reading. This is unexpected!!")
-
-			// todo: Solar radiation?
-			// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-6-solar-radiation
-			// Dario says it's 0x07, Dekay 0x06
-			// https://www.carluccio.de/davis-vue-hacking-part-2/
-			case 0x07:
-				voltage, err := DecodeSolarVoltage(message)
-				if err == nil {
-					wp.data.Solar = &SolarDatum{
-						Voltage:    voltage,
-						ReceivedAt: message.ReceivedAt,
-						RawMessage: bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved solar voltage data, will send soon", "voltage", voltage)
-				} else {
-					slog.Error("Could not decode temperature from packet", "error", err)
+		// UV Index
+		// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-4-uv-index
+		case 0x04:
+			uv, err := DecodeUVIndex(message)
+			if err == nil {
+				wp.data.UV = &UVDatum{
+					Value:       uv,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
 				}
+				slog.Info("Saved UV index data, will send soon", "uv", uv)
+			} else {
+				slog.Error("Could not decode UV index from packet", "error", err)
+			}
 
-			// Temperature
-			case 0x08:
-				temperature, err := DecodeTemperature(message)
-				if err == nil {
-					wp.data.Temperature = &TemperatureDatum{
-						Value:      temperature,
-						ReceivedAt: message.ReceivedAt,
-						RawMessage: bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved temperature data, will send soon", "temp", temperature)
-				} else {
-					slog.Error("Could not decode temperature from packet", "error", err)
+		// Rain Rate
+		case 0x05:
+			inchesPerHour, err := DecodeRainRate(message)
+			if err == nil {
+				wp.data.RainRate = &RainRateDatum{
+					InchesPerHour: inchesPerHour,
+					ReceivedAt:    message.ReceivedAt,
+					Transmitter:   message.ID,
+					RawMessage:    bytesToSpacedHex(message.Data),
 				}
+				slog.Info("Saved rain rate data, will send soon", "inchesPerHour", inchesPerHour)
+			} else {
+				slog.Error("Could not decode temperature from packet", "error", err)
+			}
 
-			// gust speed Msg-ID 0x9 (every 50 seconds):
-
-			// Humidity (every 50 seconds)
-			case 0x0A:
-				humidity, err := DecodeHumidity(message)
-				if err == nil {
-					wp.data.Humidity = &HumidityDatum{
-						Value:      humidity,
-						ReceivedAt: message.ReceivedAt,
-						RawMessage: bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved humidity data, will send soon", "temp", humidity)
-				} else {
-					slog.Error("Could not decode humidity from packet", "error", err)
+		// Solar radiation
+		// https://github.com/dekay/DavisRFM69/wiki/Message-Protocol#message-6-solar-radiation
+		case 0x06:
+			radiation, err := DecodeSolarRadiation(message)
+			if err == nil {
+				wp.data.SolarRadiation = &SolarRadiationDatum{
+					Value:       radiation,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
 				}
+				slog.Info("Saved solar radiation data, will send soon", "radiation", radiation)
+			} else {
+				slog.Error("Could not decode solar radiation from packet", "error", err)
+			}
 
-			// Rain clicks
-			case 0x0E:
-				totalClicks, err := DecodeRainfall(message)
-				if err == nil {
-					wp.data.Rainfall = &RainfallDatum{
-						TotalClicks: totalClicks,
-						ReceivedAt:  message.ReceivedAt,
-						RawMessage:  bytesToSpacedHex(message.Data),
-					}
-					slog.Info("Saved rainfall data, will send soon", "rainfallClicks", totalClicks)
-				} else {
-					slog.Error("Could not decode rainfall from packet", "error", err)
+		// Solar panel voltage
+		// Dario says solar radiation is 0x07, Dekay 0x06
+		// https://www.carluccio.de/davis-vue-hacking-part-2/
+		case 0x07:
+			voltage, err := DecodeSolarVoltage(message)
+			if err == nil {
+				wp.data.Solar = &SolarDatum{
+					Voltage:     voltage,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
 				}
-
-			default:
-				slog.Info("Unknown message type", "raw_message", bytesToSpacedHex(message.Data), "message_type", GetMessageType(message))
+				slog.Info("Saved solar voltage data, will send soon", "voltage", voltage)
+			} else {
+				slog.Error("Could not decode temperature from packet", "error", err)
 			}
 
-			wp.mutex.Unlock()
-		case <-wp.done:
-			return
-		}
-	}
-}
-
-func (bp *WeatherProcessor) sendDataPeriodically() {
-	ticker := time.NewTicker(bp.interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			bp.mutex.Lock()
-			if bp.hasSomeDataFields() {
-				bp.sendData()
+		// Temperature
+		case 0x08:
+			temperature, err := DecodeTemperature(message)
+			if err == nil {
+				wp.data.Temperature = &TemperatureDatum{
+					Value:       temperature,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
+				}
+				slog.Info("Saved temperature data, will send soon", "temp", temperature)
+			} else {
+				slog.Error("Could not decode temperature from packet", "error", err)
 			}
-			bp.mutex.Unlock()
-		case <-bp.done:
-			return
-		}
-	}
-}
-
-func (wp *WeatherProcessor) sendData() {
-	if !wp.hasSomeDataFields() {
-		return
-	}
 
-	wp.data.SentAt = time.Now()
-	payload, err := json.Marshal(wp.data)
-	if err != nil {
-		slog.Error("Error marshaling data to JSON", "error", err)
-		return
-	}
+		// Gust speed (every 50 seconds)
+		case 0x09:
+			speed, index, err := DecodeGust(message)
+			if err == nil {
+				wp.data.Gust = &GustDatum{
+					Speed:       speed,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
+				}
+				slog.Info("Saved gust data, will send soon", "speed", speed, "index", index)
+			} else {
+				slog.Error("Could not decode gust from packet", "error", err)
+			}
 
-	// Create the HTTP POST request
-	req, err := http.NewRequest("POST", wp.serverURL, bytes.NewBuffer(payload))
-	if err != nil {
-		slog.Error("Error creating POST request", "error", err)
-		return
-	}
+		// Humidity (every 50 seconds)
+		case 0x0A:
+			humidity, sensor, err := DecodeHumidity(message)
+			if err == nil {
+				wp.data.Humidity = &HumidityDatum{
+					Value:       humidity,
+					Sensor:      sensor,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
+				}
+				slog.Info("Saved humidity data, will send soon", "temp", humidity, "sensor", sensor)
+			} else {
+				slog.Error("Could not decode humidity from packet", "error", err)
+			}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", wp.apiKey)
+		// Rain clicks
+		case 0x0E:
+			totalClicks, err := DecodeRainfall(message)
+			if err == nil {
+				wp.data.Rainfall = &RainfallDatum{
+					TotalClicks: totalClicks,
+					ReceivedAt:  message.ReceivedAt,
+					Transmitter: message.ID,
+					RawMessage:  bytesToSpacedHex(message.Data),
+				}
+				slog.Info("Saved rainfall data, will send soon", "rainfallClicks", totalClicks)
+			} else {
+				slog.Error("Could not decode rainfall from packet", "error", err)
+			}
 
-	// Send the HTTP POST request
-	resp, err := wp.httpClient.Do(req)
-	if err != nil {
-		slog.Error("Error POSTing data", "error", err, "payload", payload)
-		return
-	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			slog.Error("Error closing response body", "error", closeErr)
+		default:
+			slog.Info("Unknown message type", "raw_message", bytesToSpacedHex(message.Data), "message_type", GetMessageType(message))
 		}
-	}()
+		wp.derive(message.ID, message.ReceivedAt)
+		wp.transmitters[message.ID] = merge(wp.transmitters[message.ID], newReadings(wp.data, before))
 
-	slog.Info("Successfully POSTed weather data", "payload", payload)
-
-	if resp.StatusCode != http.StatusCreated {
-		slog.Error("Server returned non-Created status", "status", resp.Status)
-		return
+		wp.mutex.Unlock()
 	}
-
-	wp.clearData()
-}
-
-// Clear out any existing weather data.
-func (wp *WeatherProcessor) clearData() {
-	slog.Info("Clearing data")
-	wp.data = WeatherDatum{}
 }
 
+// AddMessage queues a message to be decoded.  Messages added after Stop
+// are dropped.
 func (wp *WeatherProcessor) AddMessage(message protocol.Message) {
+	wp.intake.RLock()
+	defer wp.intake.RUnlock()
+
+	if wp.stopped {
+		slog.Info("Dropping message added after stop", "raw_message", bytesToSpacedHex(message.Data))
+		return
+	}
 	wp.messageChan <- message
 }
 
-func (bp *WeatherProcessor) Stop() {
-	close(bp.done)
-
-	// Send any remaining messages
-	func() {
-		bp.mutex.Lock()
-		defer bp.mutex.Unlock()
-		if bp.hasSomeDataFields() {
-			bp.sendData()
-		}
-	}()
-
-	// Close any idle connections
-	if transport, ok := bp.httpClient.Transport.(*http.Transport); ok {
-		transport.CloseIdleConnections()
+// Stop stops taking messages, decodes the ones already queued and waits for
+// the sinks to send what they have left.
+func (wp *WeatherProcessor) Stop() {
+	wp.intake.Lock()
+	if !wp.stopped {
+		wp.stopped = true
+		close(wp.messageChan)
 	}
+	wp.intake.Unlock()
+
+	<-wp.done
+	wp.sinks.Wait()
 }
 
 // func main() {
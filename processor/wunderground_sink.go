@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"log/slog"
+)
+
+// WundergroundURL is the Weather Underground personal weather station
+// upload endpoint.
+const WundergroundURL = "https://weatherstation.wunderground.com/weatherstation/updateweatherstation.php"
+
+// WundergroundSink uploads observations with the Weather Underground PWS
+// protocol: a GET with the station ID, key and readings as query
+// parameters, answered by "success".  Every upload carries the latest
+// value of each reading, not only the new ones.
+type WundergroundSink struct {
+	URL       string
+	StationID string
+	Key       string
+
+	httpClient *http.Client
+	latest     WeatherDatum // merged from every Send
+}
+
+func NewWundergroundSink(stationID, key string) *WundergroundSink {
+	return &WundergroundSink{
+		URL:        WundergroundURL,
+		StationID:  stationID,
+		Key:        key,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WundergroundSink) Name() string {
+	return "wunderground"
+}
+
+// Ready waits for a temperature; an upload without one is of little use.
+func (s *WundergroundSink) Ready(data WeatherDatum) bool {
+	return !data.empty() && (data.Temperature != nil || s.latest.Temperature != nil)
+}
+
+func (s *WundergroundSink) Send(data WeatherDatum) error {
+	latest := merge(s.latest, data)
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = WundergroundQuery(s.StationID, s.Key, latest).Encode()
+	resp, err := s.httpClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Error("Error closing response body", "error", closeErr)
+		}
+	}()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	body = bytes.TrimSpace(body)
+	switch {
+	case resp.StatusCode == http.StatusOK && string(body) == "success":
+		s.latest = latest
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || bytes.HasPrefix(body, []byte("INVALID")):
+		// Wrong station ID or key; trying again won't help.
+		s.latest = latest
+		return fmt.Errorf("wunderground returned %s: %s: %w", resp.Status, body, ErrRejected)
+	}
+	return fmt.Errorf("wunderground returned %s: %s", resp.Status, body)
+}
+
+func (s *WundergroundSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// WundergroundQuery returns the upload parameters for data.
+func WundergroundQuery(stationID, key string, data WeatherDatum) url.Values {
+	q := url.Values{
+		"ID":           {stationID},
+		"PASSWORD":     {key},
+		"action":       {"updateraw"},
+		"dateutc":      {"now"},
+		"softwaretype": {"rtldavis"},
+	}
+	float := func(v float32, prec int) string {
+		return strconv.FormatFloat(float64(v), 'f', prec, 32)
+	}
+	if d := data.Temperature; d != nil {
+		q.Set("tempf", float(d.Value, 1))
+	}
+	if d := data.Humidity; d != nil {
+		q.Set("humidity", float(d.Value, 0))
+	}
+	if d := data.DewPoint; d != nil {
+		q.Set("dewptf", float(d.Value, 1))
+	}
+	if d := data.Wind; d != nil {
+		q.Set("windspeedmph", strconv.Itoa(int(d.Speed)))
+		q.Set("winddir", strconv.Itoa(int(d.Direction)))
+	}
+	if d := data.PeakWind; d != nil {
+		q.Set("windgustmph", strconv.Itoa(int(d.Speed)))
+		q.Set("windgustdir", strconv.Itoa(int(d.Direction)))
+	}
+	if d := data.UV; d != nil {
+		q.Set("UV", float(d.Value, 1))
+	}
+	if d := data.SolarRadiation; d != nil {
+		q.Set("solarradiation", float(d.Value, 0))
+	}
+	if d := data.RainTotals; d != nil {
+		q.Set("rainin", float(d.LastHour, 2))
+		q.Set("dailyrainin", float(d.Daily, 2))
+	}
+	return q
+}
@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWundergroundQuery(t *testing.T) {
+	q := WundergroundQuery("KCASANFR1", "secret", WeatherDatum{
+		Temperature: &TemperatureDatum{Value: 72.46},
+		Humidity:    &HumidityDatum{Value: 55.5},
+		DewPoint:    &DewPointDatum{Value: 55.2},
+		Wind:        &WindDatum{Speed: 4, Direction: 270},
+		PeakWind:    &PeakWindDatum{Speed: 11, Direction: 260},
+		RainTotals:  &RainTotalsDatum{Daily: 0.42, LastHour: 0.1},
+		UV:          &UVDatum{Value: 3.4},
+
+		SolarRadiation: &SolarRadiationDatum{Value: 596},
+	})
+	assert.Equal(t, url.Values{
+		"ID":             {"KCASANFR1"},
+		"PASSWORD":       {"secret"},
+		"action":         {"updateraw"},
+		"dateutc":        {"now"},
+		"softwaretype":   {"rtldavis"},
+		"tempf":          {"72.5"},
+		"humidity":       {"56"},
+		"dewptf":         {"55.2"},
+		"windspeedmph":   {"4"},
+		"winddir":        {"270"},
+		"windgustmph":    {"11"},
+		"windgustdir":    {"260"},
+		"rainin":         {"0.10"},
+		"dailyrainin":    {"0.42"},
+		"UV":             {"3.4"},
+		"solarradiation": {"596"},
+	}, q)
+}
+
+func TestWundergroundSink(t *testing.T) {
+	queries := make(chan url.Values, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/weatherstation/updateweatherstation.php", r.URL.Path)
+		queries <- r.URL.Query()
+		_, _ = w.Write([]byte("success\n"))
+	}))
+	defer server.Close()
+
+	wp := NewWeatherProcessor(10)
+	sink := NewWundergroundSink("KCASANFR1", "secret")
+	sink.URL = server.URL + "/weatherstation/updateweatherstation.php"
+	assert.False(t, sink.Ready(WeatherDatum{Humidity: &HumidityDatum{}}), "waits for a temperature")
+	wp.AddSink(sink, 20*time.Millisecond)
+	defer wp.Stop()
+
+	process(t, wp, temperatureMsg, humidityMsg)
+	var q url.Values
+	require.Eventually(t, func() bool {
+		select {
+		case q = <-queries:
+			return q.Get("humidity") != ""
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "KCASANFR1", q.Get("ID"))
+	assert.NotEmpty(t, q.Get("tempf"))
+	assert.NotEmpty(t, q.Get("dewptf"))
+
+	// Later uploads still carry the temperature.
+	process(t, wp, []byte{0xE0, 0x03, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00})
+	require.Eventually(t, func() bool {
+		select {
+		case q = <-queries:
+			return q.Get("dailyrainin") != ""
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	assert.NotEmpty(t, q.Get("tempf"))
+}
+
+func TestWundergroundSinkRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("INVALIDPASSWORDID|Password or key and/or id are incorrect\n"))
+	}))
+	defer server.Close()
+
+	sink := NewWundergroundSink("KCASANFR1", "wrong")
+	sink.URL = server.URL
+	err := sink.Send(WeatherDatum{Temperature: &TemperatureDatum{Value: 70}})
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.Contains(t, err.Error(), "INVALIDPASSWORDID")
+}
@@ -79,6 +79,9 @@ type Parser struct {
 	freqerrTrChPtr [maxTr][maxCh]int
 	maxTrChList    int
 	factor         float32
+
+	corrector   *crc.Corrector
+	crcFailures int
 }
 
 func NewParser(symbolLength int, tf string) (p Parser) {
@@ -206,6 +209,22 @@ func (p *Parser) SeqToHop(n int) int {
 	return p.hopPattern[n%p.ChannelCount]
 }
 
+// SetRepair enables repair of packets with up to bits flipped bits; 0
+// drops every packet that fails the checksum.  Repairing two bits lets
+// roughly one in thirty packets of noise through, so use it with care.
+func (p *Parser) SetRepair(bits int) {
+	p.corrector = nil
+	if bits > 0 {
+		p.corrector = crc.NewCorrector(p.CRC, p.Cfg.PacketSymbols/8-2, bits)
+	}
+}
+
+// CRCFailures returns the number of packets dropped because the checksum
+// failed and they could not be repaired.
+func (p *Parser) CRCFailures() int {
+	return p.crcFailures
+}
+
 // Given a list of packets, check them for validity and ignore duplicates,
 // return a list of parsed messages.
 func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
@@ -223,9 +242,25 @@ func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
 		}
 		seen[s] = true
 
-		// If the checksum fails, bail.
+		// If the checksum fails, try to repair the packet or bail.
+		repaired := 0
 		if p.Checksum(pkt.Data[2:]) != 0 {
-			continue
+			if p.corrector == nil {
+				p.crcFailures++
+				continue
+			}
+			n, ok := p.corrector.Correct(pkt.Data[2:])
+			if !ok {
+				p.crcFailures++
+				continue
+			}
+			// The repaired packet may be one already found intact.
+			s = string(pkt.Data)
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+			repaired = n
 		}
 		// Thanks to Steve Wormley for an improved calculation of freqError.
 		// Look at the packet's preamble to determine frequency error between
@@ -255,6 +290,8 @@ func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
 		// measured in radians.
 		freqerr := -int((mean * float64(p.Cfg.SampleRate)) / (2 * math.Pi))
 		msg := NewMessage(pkt)
+		msg.FreqError = freqerr
+		msg.Repaired = repaired
 		msgs = append(msgs, msg)
 		// Per transmitter and per channel we have a list of p.maxTrChList frequency errors
 		// The average value of the frequencu erreors in the list is used for the frequency correction.
@@ -271,10 +308,13 @@ type Message struct {
 	ID         byte
 	BatteryLow bool
 	ReceivedAt time.Time
+	FreqError  int // Hz the transmitter is off the tuned frequency, measured on the preamble
+	Repaired   int // bits flipped to make the checksum pass
 }
 
 func NewMessage(pkt dsp.Packet) (m Message) {
 	m.Idx = pkt.Idx
+	m.RSSI, m.Noise, m.SNR = pkt.RSSI, pkt.Noise, pkt.SNR
 	m.Data = make([]byte, len(pkt.Data)-2)
 	copy(m.Data, pkt.Data[2:])
 	m.ID = m.Data[0] & 0x7
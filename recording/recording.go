@@ -0,0 +1,164 @@
+/*
+Package recording captures the raw IQ stream seen by the receiver together
+with a sidecar log of every hop and decoded message, so that a missed
+packet or a bad decode in the field can be reproduced later at a desk.
+
+A recording is two files: the samples exactly as read from the sample
+source (unsigned 8-bit IQ, the same .cu8 format rtl_sdr writes) and a
+sidecar of JSON lines.  Every sidecar event carries the number of sample
+blocks written before it, which ties hops and messages to a position in
+the IQ file.
+*/
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// Sidecar event types.
+const (
+	EventStart   = "start"
+	EventHop     = "hop"
+	EventMessage = "message"
+)
+
+// Header describes how the samples in a recording were taken.
+type Header struct {
+	SampleRate      int    `json:"sample_rate"`
+	BlockSize       int    `json:"block_size"` // bytes per block
+	TransmitterFreq string `json:"tf"`         // EU, US or NZ
+}
+
+// MessageRecord is a decoded message as logged in the sidecar.
+type MessageRecord struct {
+	ID         byte   `json:"id"`
+	Idx        int    `json:"idx"`
+	Data       string `json:"data"` // hex
+	BatteryLow bool   `json:"battery_low"`
+	Repaired   int    `json:"repaired,omitempty"`
+}
+
+// Event is one line of the sidecar.
+type Event struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Block int64     `json:"block"` // blocks written before this event
+
+	Header  *Header        `json:"header,omitempty"`
+	Hop     *protocol.Hop  `json:"hop,omitempty"`
+	Tuned   int            `json:"tuned,omitempty"` // frequency actually set, corrections included
+	Message *MessageRecord `json:"message,omitempty"`
+}
+
+// SidecarPath returns the sidecar file name belonging to an IQ file.
+func SidecarPath(iqPath string) string {
+	return strings.TrimSuffix(iqPath, filepath.Ext(iqPath)) + ".jsonl"
+}
+
+// Recorder writes a recording.  Blocks are written from the receive loop
+// while hops are logged from the hop goroutine, so all methods are safe for
+// concurrent use.
+type Recorder struct {
+	mutex   sync.Mutex
+	iqFile  *os.File
+	iq      *bufio.Writer
+	sidecar *os.File
+	enc     *json.Encoder
+	blocks  int64
+}
+
+// Create starts a new recording at iqPath, with the sidecar next to it.
+func Create(iqPath string, header Header) (*Recorder, error) {
+	// The sidecar would overwrite the samples.
+	if SidecarPath(iqPath) == iqPath {
+		return nil, fmt.Errorf("recording to %s: the IQ file can't have the sidecar's .jsonl extension", iqPath)
+	}
+	iqFile, err := os.Create(iqPath)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := os.Create(SidecarPath(iqPath))
+	if err != nil {
+		_ = iqFile.Close()
+		return nil, err
+	}
+
+	r := &Recorder{
+		iqFile:  iqFile,
+		iq:      bufio.NewWriterSize(iqFile, 64*1024),
+		sidecar: sidecar,
+		enc:     json.NewEncoder(sidecar),
+	}
+	if err := r.log(Event{Type: EventStart, Time: time.Now(), Header: &header}); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// WriteBlock appends one block of samples to the IQ file.
+func (r *Recorder) WriteBlock(block []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.iq.Write(block); err != nil {
+		return err
+	}
+	r.blocks++
+	return nil
+}
+
+// Hop logs a retune.  tuned is the frequency handed to the sample source.
+func (r *Recorder) Hop(hop protocol.Hop, tuned int, t time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.log(Event{Type: EventHop, Time: t, Hop: &hop, Tuned: tuned})
+}
+
+// Message logs a message decoded from the samples written so far.
+func (r *Recorder) Message(m protocol.Message) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.log(Event{
+		Type: EventMessage,
+		Time: m.ReceivedAt,
+		Message: &MessageRecord{
+			ID:         m.ID,
+			Idx:        m.Idx,
+			Data:       fmt.Sprintf("%02X", m.Data),
+			BatteryLow: m.BatteryLow,
+			Repaired:   m.Repaired,
+		},
+	})
+}
+
+func (r *Recorder) log(e Event) error {
+	e.Block = r.blocks
+	return r.enc.Encode(e)
+}
+
+// Close flushes and closes both files.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := r.iq.Flush()
+	if closeErr := r.iqFile.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := r.sidecar.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/sim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSidecarPath(t *testing.T) {
+	assert.Equal(t, "/tmp/capture.jsonl", SidecarPath("/tmp/capture.cu8"))
+	assert.Equal(t, "capture.jsonl", SidecarPath("capture"))
+}
+
+func TestCreateWithSidecarExtension(t *testing.T) {
+	iqPath := filepath.Join(t.TempDir(), "capture.jsonl")
+	_, err := Create(iqPath, Header{SampleRate: 268800, BlockSize: 4, TransmitterFreq: "US"})
+	assert.ErrorContains(t, err, "sidecar's .jsonl extension")
+	assert.NoFileExists(t, iqPath)
+}
+
+func TestOpenWithIncompleteEvents(t *testing.T) {
+	const start = `{"type":"start","time":"2025-03-01T12:00:00Z","header":{"sample_rate":268800,"block_size":4}}`
+	tests := []struct {
+		name    string
+		sidecar string
+		err     string
+	}{
+		{"start without header", `{"type":"start","time":"2025-03-01T12:00:00Z"}`, "start event has no header"},
+		{"hop without hop", start + "\n" + `{"type":"hop","time":"2025-03-01T12:00:01Z","block":1}`, "hop event has no hop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iqPath := filepath.Join(t.TempDir(), "capture.cu8")
+			require.NoError(t, os.WriteFile(iqPath, nil, 0o644))
+			require.NoError(t, os.WriteFile(SidecarPath(iqPath), []byte(tt.sidecar+"\n"), 0o644))
+
+			_, err := Open(iqPath)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestRecorderWritesBlocksAndEvents(t *testing.T) {
+	iqPath := filepath.Join(t.TempDir(), "capture.cu8")
+	r, err := Create(iqPath, Header{SampleRate: 268800, BlockSize: 4, TransmitterFreq: "US"})
+	require.NoError(t, err)
+
+	require.NoError(t, r.WriteBlock([]byte{1, 2, 3, 4}))
+	hop := protocol.Hop{ChannelIdx: 19, ChannelFreq: 911952597, FreqCorr: -120, Transmitter: 0}
+	require.NoError(t, r.Hop(hop, 911952477, time.Now()))
+	require.NoError(t, r.WriteBlock([]byte{5, 6, 7, 8}))
+	msg := protocol.NewMessage(dsp.Packet{Idx: 42, Data: []byte{0xCB, 0x89, 0x80, 0x00, 0x00, 0x33, 0x8D, 0x00, 0x25, 0x11}})
+	require.NoError(t, r.Message(msg))
+	require.NoError(t, r.Close())
+
+	iq, err := os.ReadFile(iqPath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, iq)
+
+	f, err := os.Open(SidecarPath(iqPath))
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 3)
+
+	assert.Equal(t, EventStart, events[0].Type)
+	assert.Equal(t, 268800, events[0].Header.SampleRate)
+
+	assert.Equal(t, EventHop, events[1].Type)
+	assert.Equal(t, int64(1), events[1].Block)
+	assert.Equal(t, hop, *events[1].Hop)
+	assert.Equal(t, 911952477, events[1].Tuned)
+
+	assert.Equal(t, EventMessage, events[2].Type)
+	assert.Equal(t, int64(2), events[2].Block)
+	assert.Equal(t, "800000338D002511", events[2].Message.Data)
+	assert.Equal(t, 42, events[2].Message.Idx)
+}
+
+func TestReplayAppliesHopsAndCountsBlocks(t *testing.T) {
+	iqPath := filepath.Join(t.TempDir(), "noise.cu8")
+	p := protocol.NewParser(14, "EU")
+	r, err := Create(iqPath, Header{SampleRate: p.Cfg.SampleRate, BlockSize: p.Cfg.BlockSize2, TransmitterFreq: "EU"})
+	require.NoError(t, err)
+
+	block := make([]byte, p.Cfg.BlockSize2)
+	for i := range block {
+		block[i] = 127
+	}
+	for i := 0; i < 10; i++ {
+		if i == 0 || i == 5 {
+			require.NoError(t, r.Hop(p.SetHop(i, 0), 0, time.Now()))
+		}
+		require.NoError(t, r.WriteBlock(block))
+	}
+	require.NoError(t, r.Close())
+
+	pl, err := Open(iqPath)
+	require.NoError(t, err)
+	defer func() { _ = pl.Close() }()
+	assert.Equal(t, "EU", pl.Header.TransmitterFreq)
+
+	replayed := protocol.NewParser(14, pl.Header.TransmitterFreq)
+	stats, err := pl.Run(&replayed, func(protocol.Message) {})
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Blocks: 10, Hops: 2, Found: 0, Recorded: 0}, stats)
+}
+
+func TestReplayFindsRecordedPackets(t *testing.T) {
+	iqPath := filepath.Join(t.TempDir(), "packet.cu8")
+	p := protocol.NewParser(14, "US")
+	r, err := Create(iqPath, Header{SampleRate: p.Cfg.SampleRate, BlockSize: p.Cfg.BlockSize2, TransmitterFreq: "US"})
+	require.NoError(t, err)
+	require.NoError(t, r.Hop(p.SetHop(0, 0), 0, time.Now()))
+
+	m := sim.NewModulator(&p.Cfg, 1)
+	m.Noise = 0.02
+	iq := m.Silence(4000)
+	iq = append(iq, m.Modulate(sim.Frame([]byte{0x80, 0x00, 0x00, 0x33, 0x8D, 0x00}))...)
+	iq = append(iq, m.Silence(4000)...)
+	for ; len(iq) >= p.Cfg.BlockSize2; iq = iq[p.Cfg.BlockSize2:] {
+		block := iq[:p.Cfg.BlockSize2]
+		require.NoError(t, r.WriteBlock(block))
+		for _, msg := range p.Parse(p.Demodulate(block)) {
+			require.NoError(t, r.Message(msg))
+		}
+	}
+	require.NoError(t, r.Close())
+
+	pl, err := Open(iqPath)
+	require.NoError(t, err)
+	defer func() { _ = pl.Close() }()
+
+	var found []protocol.Message
+	replayed := protocol.NewParser(14, pl.Header.TransmitterFreq)
+	stats, err := pl.Run(&replayed, func(msg protocol.Message) { found = append(found, msg) })
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Found)
+	assert.Equal(t, 1, stats.Recorded)
+	require.Len(t, found, 1)
+	assert.Equal(t, fmt.Sprintf("%02X", found[0].Data), pl.Messages[0].Message.Data)
+	assert.True(t, found[0].ReceivedAt.After(pl.Start))
+}
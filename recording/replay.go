@@ -0,0 +1,124 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// Player reads a recording back.
+type Player struct {
+	Header Header
+	Start  time.Time
+
+	iqFile *os.File
+	iq     *bufio.Reader
+	hops   []Event
+	// Messages are the messages decoded while the recording was made.
+	Messages []Event
+}
+
+// ReplayStats summarizes one replay.
+type ReplayStats struct {
+	Blocks   int64 // blocks demodulated
+	Hops     int   // hops applied
+	Found    int   // messages found now
+	Recorded int   // messages found when the recording was made
+}
+
+func (s ReplayStats) String() string {
+	return fmt.Sprintf("{Blocks:%d Hops:%d Found:%d Recorded:%d}", s.Blocks, s.Hops, s.Found, s.Recorded)
+}
+
+// Open opens the recording at iqPath and loads its sidecar.
+func Open(iqPath string) (*Player, error) {
+	sidecar, err := os.Open(SidecarPath(iqPath))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = sidecar.Close() }()
+
+	pl := &Player{}
+	dec := json.NewDecoder(sidecar)
+	for {
+		var e Event
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", SidecarPath(iqPath), err)
+		}
+
+		switch e.Type {
+		case EventStart:
+			if e.Header == nil {
+				return nil, fmt.Errorf("reading %s: start event has no header", SidecarPath(iqPath))
+			}
+			pl.Header = *e.Header
+			pl.Start = e.Time
+		case EventHop:
+			if e.Hop == nil {
+				return nil, fmt.Errorf("reading %s: hop event has no hop", SidecarPath(iqPath))
+			}
+			pl.hops = append(pl.hops, e)
+		case EventMessage:
+			pl.Messages = append(pl.Messages, e)
+		}
+	}
+	if pl.Header.BlockSize == 0 || pl.Header.SampleRate == 0 {
+		return nil, errors.New("recording has no start header")
+	}
+
+	pl.iqFile, err = os.Open(iqPath)
+	if err != nil {
+		return nil, err
+	}
+	pl.iq = bufio.NewReaderSize(pl.iqFile, 64*1024)
+	return pl, nil
+}
+
+// Run feeds every recorded block through the parser's demodulator and
+// parser, retuning the parser at the same block positions as during the
+// recording, and passes each message found to emit.  It runs as fast as
+// the samples can be processed.  Message timestamps are derived from the
+// block position so that repeated runs give identical output.
+//
+// The parser should be fresh, built with the transmitter frequencies in
+// Header, so that its demodulator and frequency error history start empty.
+func (pl *Player) Run(p *protocol.Parser, emit func(protocol.Message)) (stats ReplayStats, err error) {
+	stats.Recorded = len(pl.Messages)
+	blockDuration := time.Duration(pl.Header.BlockSize/2) * time.Second / time.Duration(pl.Header.SampleRate)
+
+	block := make([]byte, pl.Header.BlockSize)
+	next := 0
+	for {
+		if _, err := io.ReadFull(pl.iq, block); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+
+		for ; next < len(pl.hops) && pl.hops[next].Block <= stats.Blocks; next++ {
+			hop := pl.hops[next].Hop
+			p.SetHop(p.HopToSeq(hop.ChannelIdx), hop.Transmitter)
+			stats.Hops++
+		}
+
+		receivedAt := pl.Start.Add(time.Duration(stats.Blocks+1) * blockDuration)
+		for _, msg := range p.Parse(p.Demodulate(block)) {
+			msg.ReceivedAt = receivedAt
+			stats.Found++
+			emit(msg)
+		}
+		stats.Blocks++
+	}
+}
+
+func (pl *Player) Close() error {
+	return pl.iqFile.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	rtlsdr "github.com/jpoirier/gortlsdr"
+)
+
+// rtlsdrSource is the source.SampleSource backed by a local USB dongle.
+type rtlsdrSource struct {
+	dev *rtlsdr.Context
+	in  *io.PipeReader
+	out *io.PipeWriter
+}
+
+// openRtlsdr opens the dongle named by device, which is either a serial
+// number or a device index.
+func openRtlsdr(device string) (*rtlsdrSource, error) {
+	index, _ := rtlsdr.GetIndexBySerial(device)
+	if index < 0 {
+		var err error
+		index, err = strconv.Atoi(device)
+		if err != nil {
+			return nil, fmt.Errorf("device %q is neither a serial number nor an index", device)
+		}
+	}
+
+	dev, err := rtlsdr.Open(index)
+	if err != nil {
+		return nil, err
+	}
+	in, out := io.Pipe()
+	return &rtlsdrSource{dev: dev, in: in, out: out}, nil
+}
+
+func (s *rtlsdrSource) Read(p []byte) (int, error) {
+	return s.in.Read(p)
+}
+
+func (s *rtlsdrSource) SetCenterFreq(freq int) error {
+	return s.dev.SetCenterFreq(freq)
+}
+
+func (s *rtlsdrSource) SetSampleRate(rate int) error {
+	return s.dev.SetSampleRate(rate)
+}
+
+func (s *rtlsdrSource) SetTunerGain(gain int) error {
+	// set SetTunerGainMode
+	manualGainMode := gain != 0
+	if err := s.dev.SetTunerGainMode(manualGainMode); err != nil {
+		return err
+	}
+
+	if gain != 0 {
+		gains, err := s.dev.GetTunerGains()
+		if err != nil {
+			log.Printf("GetTunerGains Failed - error: %s\n", err)
+		} else if len(gains) > 0 {
+			gainInfo := "Supported tuner gain: "
+			for i := 0; i < len(gains); i++ {
+				gainInfo += fmt.Sprintf("%d Db ", int(gains[i]))
+			}
+			log.Printf("%s", gainInfo)
+		}
+		err = s.dev.SetTunerGain(gain)
+		if err != nil {
+			log.Printf("SetTunerGain %d gain Failed, error: %s\n", gain, err)
+		} else {
+			log.Printf("SetTunerGain %d Successful\n", gain)
+		}
+	}
+
+	tgain := s.dev.GetTunerGain()
+	log.Printf("GetTunerGain: %d Db\n", tgain)
+	return nil
+}
+
+func (s *rtlsdrSource) SetFreqCorrection(ppm int) error {
+	return s.dev.SetFreqCorrection(ppm)
+}
+
+func (s *rtlsdrSource) Start(blockSize int) error {
+	if err := s.dev.ResetBuffer(); err != nil {
+		return err
+	}
+
+	go func() {
+		err := s.dev.ReadAsync(func(buf []byte) {
+			_, err := s.out.Write(buf)
+			if err != nil {
+				log.Printf("Error in writing buffer: %v\n", err)
+			}
+		}, nil, 1, blockSize)
+		if err != nil {
+			log.Printf("Error in ReadAsync: %v\n", err)
+			return
+		}
+	}()
+	return nil
+}
+
+func (s *rtlsdrSource) Close() error {
+	// First, cancel async reading to stop the goroutine
+	s.dev.CancelAsync()
+
+	// Close pipes after async is cancelled
+	s.out.Close()
+	s.in.Close()
+
+	// Finally close the device
+	return s.dev.Close()
+}
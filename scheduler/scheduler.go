@@ -0,0 +1,329 @@
+/*
+Package scheduler holds the frequency hopping state machine: it
+synchronizes with each transmitter, predicts on which channel and at what
+time the next packet will arrive, and accounts for missed packets.
+
+Every Davis transmitter hops through the same channel sequence, but the
+loop period depends on its ID: 2.5625 seconds for ID 0 plus 62.5 ms per
+higher ID.  When listening to several transmitters the scheduler always
+waits for whichever one is due next.
+
+The scheduler never reads the clock itself; callers pass the current time
+in, so tests can drive it with simulated time.
+
+Adapted from the globals in main.go by Luc Heijst (March 2019, May 2020).
+*/
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// MaxTransmitters is the number of transmitter IDs Davis supports.
+const MaxTransmitters = 8
+
+// undefinedChan marks an ID we are not listening to in msgIdToChan.
+const undefinedChan = 9
+
+// A Hopper maps hop sequence positions to channels and computes the
+// frequency corrections; protocol.Parser is the real one.
+type Hopper interface {
+	SetHop(n int, tr int) protocol.Hop
+	HopToSeq(n int) int
+	SeqToHop(n int) int
+}
+
+// Config holds the scheduler settings.
+type Config struct {
+	// Transmitters to listen for as a bit mask: ID 0 = 1, ID 1 = 2, ID 2 = 4 ...
+	Transmitters int
+	// ChannelCount is the number of channels in the hop sequence (EU=5, US and NZ=51).
+	ChannelCount int
+	// MaxMissed is the number of packets in a row a transmitter may miss
+	// before all transmitters are synchronized again.
+	MaxMissed int
+	// ReceiveWindow is how long past the expected arrival time we keep listening.
+	ReceiveWindow time.Duration
+	// Extra is added to every wait, for receivers that keep missing packets.
+	Extra time.Duration
+}
+
+// LoopPeriod returns how long the transmitter with the given ID takes
+// between two packets.
+func LoopPeriod(id int) time.Duration {
+	return 2562500*time.Microsecond + time.Duration(id)*62500*time.Microsecond
+}
+
+// PacketKind says what the scheduler made of a packet.
+type PacketKind int
+
+const (
+	Duplicate PacketKind = iota // same data as the previous packet
+	Undefined                   // from a transmitter we are not listening to
+	Syncing                     // received while synchronizing
+	InSync                      // received while hopping in sync
+)
+
+func (k PacketKind) String() string {
+	switch k {
+	case Duplicate:
+		return "duplicate"
+	case Undefined:
+		return "undefined"
+	case Syncing:
+		return "syncing"
+	case InSync:
+		return "in sync"
+	}
+	return "unknown"
+}
+
+// Step tells the receiver where to listen next and until when.  If no
+// packet arrives before Deadline, call OnTimeout.
+type Step struct {
+	Hop      protocol.Hop
+	Deadline time.Time
+}
+
+// Stats are the scheduler's counters since startup.  Per-channel slices
+// are in the order of Transmitters.
+type Stats struct {
+	Transmitters  []int   // IDs listened to
+	Messages      []int   // messages received
+	MissedInARow  []int   // packets missed since the last one received
+	MissedPerFreq [][]int // packets missed per frequency channel
+	Undefined     [MaxTransmitters]int
+	Duplicates    int // packets with the same data as the one before
+	Inits         int // synchronizations, the first one not counted
+}
+
+type HopScheduler struct {
+	cfg    Config
+	hopper Hopper
+
+	actChan     [MaxTransmitters]int // list with actual channels (0-7)
+	msgIdToChan [MaxTransmitters]int // msgIdToChan[id] is pointer to channel in actChan
+	maxChan     int                  // number of defined (=actual) channels
+
+	expectedChanPtr int // pointer to actChan of next expected message
+	nextHopChan     int // sequence position of next hop
+
+	// per channel (index is a pointer into actChan)
+	chLastVisits  [MaxTransmitters]time.Time // last visit times
+	chNextVisits  [MaxTransmitters]time.Time // next visit times (future)
+	chTotMsgs     [MaxTransmitters]int       // total received messages since startup
+	chAlarmCnts   [MaxTransmitters]int       // numbers of missed-counts-in-a-row
+	chLastHops    [MaxTransmitters]int       // last hop sequence positions
+	chNextHops    [MaxTransmitters]int       // next hop sequence positions
+	chMissPerFreq [MaxTransmitters][]int     // transmitter missed per frequency channel
+
+	// per id (index is msg.ID)
+	idUndefs [MaxTransmitters]int // number of received messages of undefined id's since startup
+
+	totDups        int  // total of duplicate packets since startup
+	totInit        int  // total of init procedures since startup (first not counted)
+	initTransmitrs bool // synchronizing all defined channels
+	visitCount     int  // number of different active channels seen during init
+	lastRecMsg     string
+}
+
+// New returns a scheduler for the transmitters in cfg.  Call Start before
+// anything else.
+func New(cfg Config, hopper Hopper) *HopScheduler {
+	s := &HopScheduler{cfg: cfg, hopper: hopper}
+
+	// convert transmitter code to act channels
+	mask := 1
+	for i := range s.msgIdToChan {
+		s.msgIdToChan[i] = undefinedChan
+		if cfg.Transmitters&mask != 0 {
+			s.actChan[s.maxChan] = i
+			s.msgIdToChan[i] = s.maxChan
+			s.maxChan++
+		}
+		mask = mask << 1
+	}
+	for i := range s.chMissPerFreq {
+		s.chMissPerFreq[i] = make([]int, cfg.ChannelCount)
+	}
+	return s
+}
+
+// Transmitters returns the IDs being listened to.
+func (s *HopScheduler) Transmitters() []int {
+	return append([]int(nil), s.actChan[0:s.maxChan]...)
+}
+
+// Listening reports whether packets from id are wanted.
+func (s *HopScheduler) Listening(id byte) bool {
+	return int(id) < MaxTransmitters && s.msgIdToChan[id] != undefinedChan
+}
+
+// Synchronized reports whether every transmitter has been seen and the
+// scheduler is following their hop sequences.
+func (s *HopScheduler) Synchronized() bool {
+	return !s.initTransmitrs
+}
+
+// Start begins synchronizing: listen on the first channel of the sequence
+// until each transmitter has been heard once.
+func (s *HopScheduler) Start(now time.Time) Step {
+	s.initTransmitrs = true
+	return s.initStep(now)
+}
+
+// initStep waits on the first channel for one full rotation of the
+// pattern plus one, for the slowest transmitter.
+func (s *HopScheduler) initStep(now time.Time) Step {
+	loopPeriod := time.Duration(s.cfg.ChannelCount+2) * LoopPeriod(s.actChan[s.maxChan-1])
+	log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/time.Second)
+	return Step{Hop: s.hopper.SetHop(0, 0), Deadline: now.Add(loopPeriod)}
+}
+
+// OnPacket accounts for a packet received while tuned to channel hopIdx.
+// It returns what the packet is and, if the receiver should retune, where
+// to listen next.
+func (s *HopScheduler) OnPacket(msg protocol.Message, hopIdx int, now time.Time) (PacketKind, *Step) {
+	// Keep track of duplicate packets
+	seen := string(msg.Data)
+	if seen == s.lastRecMsg {
+		s.totDups++
+		return Duplicate, nil
+	}
+	s.lastRecMsg = seen
+
+	// check if msg comes from undefined sensor
+	if !s.Listening(msg.ID) {
+		s.idUndefs[msg.ID]++
+		return Undefined, nil
+	}
+
+	ch := s.msgIdToChan[msg.ID]
+	s.chTotMsgs[ch]++
+	s.chAlarmCnts[ch] = 0 // reset current missed count
+
+	if !s.initTransmitrs {
+		// normal hopping
+		s.chLastHops[ch] = s.hopper.HopToSeq(hopIdx)
+		s.chLastVisits[ch] = now
+		step := s.next(now)
+		return InSync, &step
+	}
+
+	if !s.chLastVisits[ch].IsZero() {
+		s.chLastVisits[ch] = now // update chLastVisits timer
+		return Syncing, nil
+	}
+
+	s.visitCount++
+	s.chLastVisits[ch] = now
+	s.chLastHops[ch] = s.hopper.HopToSeq(hopIdx)
+	log.Printf("TRANSMITTER %d SEEN", msg.ID)
+	if s.visitCount < s.maxChan {
+		return Syncing, nil
+	}
+	if s.maxChan > 1 {
+		log.Printf("ALL TRANSMITTERS SEEN")
+	}
+	s.initTransmitrs = false
+	step := s.next(now)
+	return Syncing, &step
+}
+
+// OnTimeout is called when the deadline of the last step passed without a
+// packet.  Either we missed a packet or we waited a full cycle of the
+// pattern while synchronizing without hearing everyone.
+func (s *HopScheduler) OnTimeout(now time.Time) Step {
+	if !s.initTransmitrs {
+		// packet missed
+		p := s.expectedChanPtr
+		// forget the handling of this channel; update lastVisitTime as if the packet was received
+		s.chLastVisits[p] = s.chLastVisits[p].Add(LoopPeriod(s.actChan[p]))
+		// update chLastHops as if the packet was received
+		s.chLastHops[p] = (s.chLastHops[p] + 1) % s.cfg.ChannelCount
+		// increase missed counters
+		s.chAlarmCnts[p]++
+		s.chMissPerFreq[p][s.hopper.SeqToHop(s.nextHopChan)]++
+		log.Printf("ID:%d packet missed (%d), missed per freq: %d", s.actChan[p], s.chAlarmCnts[p], s.chMissPerFreq[p])
+		for i := 0; i < s.maxChan; i++ {
+			if s.chAlarmCnts[i] > s.cfg.MaxMissed {
+				s.chAlarmCnts[i] = 0 // reset current alarm count
+				s.initTransmitrs = true
+			}
+		}
+		// test again; situation may have changed
+		if !s.initTransmitrs {
+			return s.next(now)
+		}
+	}
+
+	// reset chLastVisits
+	for i := 0; i < s.maxChan; i++ {
+		s.chLastVisits[i] = time.Time{}
+	}
+	s.visitCount = 0
+	s.totInit++
+	return s.initStep(now)
+}
+
+// next picks the transmitter due first and returns the hop to its channel.
+func (s *HopScheduler) next(now time.Time) Step {
+	s.handleNextHopChannel(now)
+	s.nextHopChan = s.chNextHops[s.expectedChanPtr]
+	nextHopTran := s.actChan[s.expectedChanPtr]
+	deadline := s.chNextVisits[s.expectedChanPtr].Add(62500*time.Microsecond + s.cfg.ReceiveWindow + s.cfg.Extra)
+	return Step{Hop: s.hopper.SetHop(s.nextHopChan, nextHopTran), Deadline: deadline}
+}
+
+func (s *HopScheduler) handleNextHopChannel(now time.Time) {
+	// calculate chNextVisits times
+	for i := 0; i < MaxTransmitters; i++ {
+		s.chNextVisits[i] = time.Time{}
+		s.chNextHops[i] = s.chLastHops[i]
+	}
+	// check lastVisits; zero values should not happen,
+	// but when it does the program will be very busy (c.q. hang)
+	for i := 0; i < s.maxChan; i++ {
+		if s.chLastVisits[i].IsZero() {
+			log.Printf("ERROR: chLastVisits[%d] should not be zero!", i)
+			s.chLastVisits[i] = now // workaround to get further
+		}
+	}
+	for i := 0; i < s.maxChan; i++ {
+		period := LoopPeriod(s.actChan[i])
+		for s.chNextVisits[i] = s.chLastVisits[i]; !s.chNextVisits[i].After(now); s.chNextVisits[i] = s.chNextVisits[i].Add(period) {
+			s.chNextHops[i] = (s.chNextHops[i] + 1) % s.cfg.ChannelCount
+		}
+	}
+	s.expectedChanPtr = earliest(s.chNextVisits[0:s.maxChan])
+}
+
+// earliest returns the index of the earliest time.
+func earliest(values []time.Time) (ptr int) {
+	for i := range values {
+		if values[i].Before(values[ptr]) {
+			ptr = i
+		}
+	}
+	return ptr
+}
+
+// Stats returns a copy of the counters.
+func (s *HopScheduler) Stats() Stats {
+	st := Stats{
+		Transmitters:  s.Transmitters(),
+		Messages:      append([]int(nil), s.chTotMsgs[0:s.maxChan]...),
+		MissedInARow:  append([]int(nil), s.chAlarmCnts[0:s.maxChan]...),
+		MissedPerFreq: make([][]int, s.maxChan),
+		Undefined:     s.idUndefs,
+		Duplicates:    s.totDups,
+		Inits:         s.totInit,
+	}
+	for i := range st.MissedPerFreq {
+		st.MissedPerFreq[i] = append([]int(nil), s.chMissPerFreq[i]...)
+	}
+	return st
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// EU hop pattern: sequence position -> channel index.
+var euPattern = []int{0, 2, 4, 1, 3}
+
+var t0 = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newScheduler(transmitters, maxMissed int) *HopScheduler {
+	p := protocol.NewParser(14, "EU")
+	return New(Config{
+		Transmitters:  transmitters,
+		ChannelCount:  p.ChannelCount,
+		MaxMissed:     maxMissed,
+		ReceiveWindow: 300 * time.Millisecond,
+	}, &p)
+}
+
+// packet returns a message from id whose data is unique for seq.
+func packet(id byte, seq int) protocol.Message {
+	return protocol.Message{
+		Packet: dsp.Packet{Data: []byte{0x80 | id, byte(seq), 0, 0, 0, 0, 0, 0}},
+		ID:     id,
+	}
+}
+
+func TestLoopPeriod(t *testing.T) {
+	assert.Equal(t, 2562500*time.Microsecond, LoopPeriod(0))
+	assert.Equal(t, 2625000*time.Microsecond, LoopPeriod(1))
+	assert.Equal(t, 3000000*time.Microsecond, LoopPeriod(7))
+}
+
+func TestInitialSync(t *testing.T) {
+	s := newScheduler(1, 4)
+
+	step := s.Start(t0)
+	assert.Equal(t, 0, step.Hop.ChannelIdx)
+	assert.Equal(t, t0.Add(7*LoopPeriod(0)), step.Deadline)
+	assert.False(t, s.Synchronized())
+
+	t1 := t0.Add(time.Second)
+	kind, next := s.OnPacket(packet(0, 0), 0, t1)
+	assert.Equal(t, Syncing, kind)
+	require.NotNil(t, next)
+	assert.True(t, s.Synchronized())
+	assert.Equal(t, euPattern[1], next.Hop.ChannelIdx)
+	assert.Equal(t, 0, next.Hop.Transmitter)
+	assert.Equal(t, t1.Add(LoopPeriod(0)+62500*time.Microsecond+300*time.Millisecond), next.Deadline)
+
+	// Follow the pattern around once.
+	for seq := 1; seq <= 5; seq++ {
+		at := t1.Add(time.Duration(seq) * LoopPeriod(0))
+		kind, next = s.OnPacket(packet(0, seq), euPattern[seq%5], at)
+		assert.Equal(t, InSync, kind)
+		require.NotNil(t, next)
+		assert.Equal(t, euPattern[(seq+1)%5], next.Hop.ChannelIdx)
+	}
+	assert.Equal(t, []int{6}, s.Stats().Messages)
+}
+
+func TestMissedPackets(t *testing.T) {
+	s := newScheduler(1, 2)
+	s.Start(t0)
+	_, step := s.OnPacket(packet(0, 0), 0, t0)
+	require.NotNil(t, step)
+
+	// Miss the packets on sequence positions 1 and 2; the scheduler keeps
+	// hopping as if they had arrived.
+	for seq := 2; seq <= 3; seq++ {
+		missedOn := step.Hop.ChannelIdx
+		step2 := s.OnTimeout(step.Deadline)
+		assert.True(t, s.Synchronized())
+		assert.Equal(t, euPattern[seq], step2.Hop.ChannelIdx)
+		assert.Equal(t, 1, s.Stats().MissedPerFreq[0][missedOn])
+		step = &step2
+	}
+	assert.Equal(t, []int{2}, s.Stats().MissedInARow)
+
+	// A packet resets the count.
+	at := t0.Add(3 * LoopPeriod(0))
+	kind, next := s.OnPacket(packet(0, 3), euPattern[3], at)
+	assert.Equal(t, InSync, kind)
+	require.NotNil(t, next)
+	assert.Equal(t, []int{0}, s.Stats().MissedInARow)
+	assert.Equal(t, euPattern[4], next.Hop.ChannelIdx)
+}
+
+func TestMaxMissedRestartsSync(t *testing.T) {
+	s := newScheduler(1, 2)
+	s.Start(t0)
+	_, step := s.OnPacket(packet(0, 0), 0, t0)
+	require.NotNil(t, step)
+
+	for i := 0; i < 3; i++ {
+		next := s.OnTimeout(step.Deadline)
+		step = &next
+	}
+	assert.False(t, s.Synchronized())
+	assert.Equal(t, 0, step.Hop.ChannelIdx)
+	assert.Equal(t, 1, s.Stats().Inits)
+
+	// Nothing heard for a whole cycle: synchronize again.
+	next := s.OnTimeout(step.Deadline)
+	assert.False(t, s.Synchronized())
+	assert.Equal(t, 2, s.Stats().Inits)
+
+	kind, resync := s.OnPacket(packet(0, 9), 0, next.Deadline.Add(-time.Second))
+	assert.Equal(t, Syncing, kind)
+	require.NotNil(t, resync)
+	assert.True(t, s.Synchronized())
+}
+
+func TestInterleavesTransmitters(t *testing.T) {
+	// IDs 0 and 2.
+	s := newScheduler(1|4, 4)
+	s.Start(t0)
+
+	kind, step := s.OnPacket(packet(0, 0), 0, t0)
+	assert.Equal(t, Syncing, kind)
+	assert.Nil(t, step, "keep listening until every transmitter is seen")
+	assert.False(t, s.Synchronized())
+
+	// ID 2 shows up on the same channel 1 s later.
+	t2 := t0.Add(time.Second)
+	kind, step = s.OnPacket(packet(2, 0), 0, t2)
+	assert.Equal(t, Syncing, kind)
+	require.NotNil(t, step)
+	assert.True(t, s.Synchronized())
+
+	// ID 0 is due first, at t0 + 2.5625 s, then ID 2 at t2 + 2.6875 s.
+	assert.Equal(t, 0, step.Hop.Transmitter)
+	assert.Equal(t, euPattern[1], step.Hop.ChannelIdx)
+
+	kind, step = s.OnPacket(packet(0, 1), euPattern[1], t0.Add(LoopPeriod(0)))
+	assert.Equal(t, InSync, kind)
+	require.NotNil(t, step)
+	assert.Equal(t, 2, step.Hop.Transmitter)
+	assert.Equal(t, euPattern[1], step.Hop.ChannelIdx)
+	assert.Equal(t, t2.Add(LoopPeriod(2)+362500*time.Microsecond), step.Deadline)
+}
+
+func TestDuplicateAndUndefinedPackets(t *testing.T) {
+	s := newScheduler(1, 4)
+	s.Start(t0)
+
+	kind, _ := s.OnPacket(packet(3, 0), 0, t0)
+	assert.Equal(t, Undefined, kind)
+	kind, _ = s.OnPacket(packet(0, 0), 0, t0)
+	assert.Equal(t, Syncing, kind)
+	kind, step := s.OnPacket(packet(0, 0), 0, t0)
+	assert.Equal(t, Duplicate, kind)
+	assert.Nil(t, step)
+
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.Undefined[3])
+	assert.Equal(t, 1, stats.Duplicates)
+	assert.Equal(t, []int{1}, stats.Messages)
+	assert.True(t, s.Listening(0))
+	assert.False(t, s.Listening(3))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/config"
+)
+
+// loadConfig reads the configuration file, if any, lets the flags given on
+// the command line override it, and stores the result in the flag globals.
+func loadConfig(path string) config.Config {
+	cfg := config.Default()
+	if path != "" {
+		var err error
+		if cfg, err = config.Load(path); err != nil {
+			log.Fatalf("Error reading config: %v", err)
+		}
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "tf":
+			cfg.Radio.Frequencies = *transmitterFreq
+		case "ppm":
+			cfg.Radio.PPM = ppm
+		case "gain":
+			cfg.Radio.Gain = gain
+		case "fc":
+			cfg.Radio.FreqCorrection = fc
+		case "d":
+			cfg.Radio.Device = *deviceString
+		case "rtltcp":
+			cfg.Radio.RTLTCP = *rtltcpAddr
+		case "noafc":
+			cfg.Radio.DisableAFC = *disableAfc
+		case "tr":
+			cfg.SetTransmitterMask(tr)
+		case "maxmissed":
+			cfg.Decoder.MaxMissed = maxmissed
+		case "ex":
+			cfg.Decoder.Extra = ex
+		case "repair":
+			cfg.Decoder.Repair = repair
+		case "u":
+			cfg.Decoder.Undefined = *undefined
+		case "v":
+			cfg.Decoder.Verbose = *verbose
+		case "record":
+			cfg.Outputs.Record = *recordPath
+		case "gs":
+			if *serverSrv == "-" {
+				cfg.Outputs.Graphite = config.DefaultGraphite("-")
+				httpOutput(&cfg).URL = ""
+			} else {
+				httpOutput(&cfg).URL = *serverSrv
+			}
+		case "ak":
+			httpOutput(&cfg).APIKey = *apiKey
+		case "spool":
+			httpOutput(&cfg).Spool = nil
+			if *spoolDir != "" {
+				httpOutput(&cfg).Spool = config.DefaultSpool(*spoolDir)
+			}
+		}
+	})
+	// -gs "" turns the upload off.
+	if cfg.Outputs.HTTP != nil && cfg.Outputs.HTTP.URL == "" {
+		cfg.Outputs.HTTP = nil
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	*transmitterFreq = cfg.Radio.Frequencies
+	ppm = cfg.Radio.PPM
+	gain = cfg.Radio.Gain
+	fc = cfg.Radio.FreqCorrection
+	*deviceString = cfg.Radio.Device
+	*rtltcpAddr = cfg.Radio.RTLTCP
+	*disableAfc = cfg.Radio.DisableAFC
+	tr = cfg.TransmitterMask()
+	maxmissed = cfg.Decoder.MaxMissed
+	ex = cfg.Decoder.Extra
+	repair = cfg.Decoder.Repair
+	*undefined = cfg.Decoder.Undefined
+	*verbose = cfg.Decoder.Verbose
+	*recordPath = cfg.Outputs.Record
+	*serverSrv, *apiKey, *spoolDir = "", "", ""
+	if h := cfg.Outputs.HTTP; h != nil {
+		*serverSrv, *apiKey = h.URL, h.APIKey
+		if h.Spool != nil {
+			*spoolDir = h.Spool.Dir
+		}
+	}
+	return cfg
+}
+
+// httpOutput returns the HTTP output, adding it if the config has none.
+func httpOutput(cfg *config.Config) *config.HTTPOutput {
+	if cfg.Outputs.HTTP == nil {
+		cfg.Outputs.HTTP = &config.HTTPOutput{Interval: 5 * time.Second}
+	}
+	return cfg.Outputs.HTTP
+}
@@ -0,0 +1,130 @@
+/*
+Package sim generates synthetic Davis ISS transmissions, so the whole
+receive chain (demodulator, parser, hop scheduler and decoders) can be
+exercised without a radio.
+*/
+package sim
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+
+	"github.com/nathanmsmith/rtldavis/crc"
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+)
+
+// DefaultDeviation is the FSK deviation of a Davis transmitter in Hz.
+const DefaultDeviation = 9500
+
+// Bits sent before the sync word; the CC1101 preamble is alternating ones
+// and zeros.
+const leadIn = "10101010101010101010101010101010"
+
+// Bits sent after the message, long enough to flush the demodulator's
+// filter.
+const leadOut = "1010101010101010"
+
+// Frame returns a message ready to transmit: the first six bytes of data
+// followed by their CCITT-16 checksum, as found in protocol.Message.Data.
+// data may be six bytes, or eight with a checksum that is recomputed.
+func Frame(data []byte) []byte {
+	frame := make([]byte, 8)
+	copy(frame, data[:6])
+	c := crc.NewCRC("CCITT-16", 0, 0x1021, 0)
+	binary.BigEndian.PutUint16(frame[6:], c.Checksum(frame[:6]))
+	return frame
+}
+
+// Modulator produces 2-FSK IQ samples in the unsigned 8-bit format read
+// from an rtl-sdr, as seen by a receiver tuned to the transmitter's
+// channel.
+type Modulator struct {
+	Cfg *dsp.PacketConfig
+
+	// Deviation is the frequency shift of a symbol from the carrier in Hz.
+	Deviation float64
+	// FreqOffset is how far the transmitter is off the tuned frequency in Hz.
+	FreqOffset float64
+	// Amplitude of the signal, where 1 is full scale.
+	Amplitude float64
+	// Noise is the standard deviation of the white gaussian noise added
+	// to each of I and Q, where 1 is full scale.
+	Noise float64
+
+	rand  *rand.Rand
+	phase float64
+}
+
+// NewModulator returns a noiseless modulator at half scale.  The seed
+// makes the generated noise reproducible.
+func NewModulator(cfg *dsp.PacketConfig, seed int64) *Modulator {
+	return &Modulator{
+		Cfg:       cfg,
+		Deviation: DefaultDeviation,
+		Amplitude: 0.5,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Bits returns the symbols sent over the air for a framed message: lead-in,
+// sync word, the message with each byte sent least significant bit first,
+// and a lead-out.
+func (m *Modulator) Bits(frame []byte) string {
+	bits := leadIn + m.Cfg.Preamble
+	for _, b := range frame {
+		for i := 7; i >= 0; i-- {
+			if protocol.SwapBitOrder(b)>>i&1 == 1 {
+				bits += "1"
+			} else {
+				bits += "0"
+			}
+		}
+	}
+	return bits + leadOut
+}
+
+// Modulate returns the samples of one transmission of frame.  Two bytes
+// are produced per sample.
+func (m *Modulator) Modulate(frame []byte) []byte {
+	bits := m.Bits(frame)
+	out := make([]byte, 0, len(bits)*m.Cfg.SymbolLength*2)
+	for _, bit := range bits {
+		freq := m.FreqOffset - m.Deviation
+		if bit == '1' {
+			freq = m.FreqOffset + m.Deviation
+		}
+		for i := 0; i < m.Cfg.SymbolLength; i++ {
+			out = m.sample(out, freq, m.Amplitude)
+		}
+	}
+	return out
+}
+
+// Silence returns n samples with no signal, only noise.
+func (m *Modulator) Silence(n int) []byte {
+	out := make([]byte, 0, n*2)
+	for i := 0; i < n; i++ {
+		out = m.sample(out, 0, 0)
+	}
+	return out
+}
+
+// sample appends one IQ sample at freq Hz from the tuned frequency.  The
+// demodulator shifts its input up by a quarter of the sample rate, so the
+// signal is generated a quarter of the sample rate below.
+func (m *Modulator) sample(out []byte, freq, amplitude float64) []byte {
+	fs := float64(m.Cfg.SampleRate)
+	m.phase += 2 * math.Pi * (freq - fs/4) / fs
+	m.phase = math.Mod(m.phase, 2*math.Pi)
+
+	i := amplitude*math.Cos(m.phase) + m.Noise*m.rand.NormFloat64()
+	q := amplitude*math.Sin(m.phase) + m.Noise*m.rand.NormFloat64()
+	return append(out, toByte(i), toByte(q))
+}
+
+// toByte is the inverse of dsp.ByteToCmplxLUT.
+func toByte(v float64) byte {
+	return byte(math.Max(0, math.Min(255, math.Round(v*127.6+127.4))))
+}
@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nathanmsmith/rtldavis/crc"
+	"github.com/nathanmsmith/rtldavis/dsp"
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Temperature message from decode_temperature_test.go.
+var temperature = []byte{0x80, 0x00, 0x00, 0x33, 0x8D, 0x00, 0x25, 0x11}
+
+// receive runs iq through a fresh parser and returns the messages found.
+func receive(iq []byte) []protocol.Message {
+	p := protocol.NewParser(14, "US")
+	p.SetHop(0, 0)
+
+	var msgs []protocol.Message
+	for ; len(iq) >= p.Cfg.BlockSize2; iq = iq[p.Cfg.BlockSize2:] {
+		msgs = append(msgs, p.Parse(p.Demodulate(iq[:p.Cfg.BlockSize2]))...)
+	}
+	return msgs
+}
+
+func transmission(m *Modulator, frame []byte) []byte {
+	iq := m.Silence(3000)
+	iq = append(iq, m.Modulate(frame)...)
+	return append(iq, m.Silence(3000)...)
+}
+
+func TestFrame(t *testing.T) {
+	frame := Frame(temperature[:6])
+	assert.Equal(t, temperature, frame)
+	assert.Equal(t, temperature, Frame([]byte{0x80, 0x00, 0x00, 0x33, 0x8D, 0x00, 0xFF, 0xFF}))
+
+	c := crc.NewCRC("CCITT-16", 0, 0x1021, 0)
+	assert.Equal(t, uint16(0), c.Checksum(frame))
+}
+
+func TestBits(t *testing.T) {
+	p := protocol.NewParser(14, "US")
+	m := NewModulator(&p.Cfg, 1)
+	bits := m.Bits([]byte{0x80, 0x01})
+	assert.Equal(t, leadIn+"1100101110001001"+"00000001"+"10000000"+leadOut, bits)
+}
+
+func TestModulateDemodulate(t *testing.T) {
+	for _, offset := range []float64{0, 5000, -5000} {
+		p := protocol.NewParser(14, "US")
+		m := NewModulator(&p.Cfg, 1)
+		m.FreqOffset = offset
+
+		msgs := receive(transmission(m, Frame(temperature)))
+		require.Len(t, msgs, 1, "offset %.0f Hz", offset)
+		assert.Equal(t, temperature, msgs[0].Data)
+		assert.Equal(t, byte(0), msgs[0].ID)
+	}
+}
+
+func TestFrequencyErrorEstimate(t *testing.T) {
+	for offset := -8000.0; offset <= 8000; offset += 2000 {
+		p := protocol.NewParser(14, "US")
+		m := NewModulator(&p.Cfg, 1)
+		m.FreqOffset = offset
+		m.Noise = 0.02
+
+		msgs := receive(transmission(m, Frame(temperature)))
+		require.Len(t, msgs, 1, "offset %.0f Hz", offset)
+		assert.InDelta(t, offset, msgs[0].FreqError, 300, "offset %.0f Hz", offset)
+	}
+}
+
+func TestSensitivity(t *testing.T) {
+	decoded := func(snr float64) (count int) {
+		p := protocol.NewParser(14, "US")
+		m := NewModulator(&p.Cfg, 42)
+		m.Amplitude = 0.1
+		// Noise is added to I and Q separately.
+		m.Noise = m.Amplitude / math.Sqrt(2*math.Pow(10, snr/10))
+		for i := 0; i < 20; i++ {
+			count += len(receive(transmission(m, Frame(temperature))))
+		}
+		return count
+	}
+
+	assert.Equal(t, 20, decoded(20), "every packet decodes at 20 dB SNR")
+	assert.Less(t, decoded(-10), 2, "packets drown at -10 dB SNR")
+}
+
+func TestSignalStrength(t *testing.T) {
+	p := protocol.NewParser(14, "US")
+	m := NewModulator(&p.Cfg, 1)
+	m.Noise = 0.02
+
+	msgs := receive(transmission(m, Frame(temperature)))
+	require.Len(t, msgs, 1)
+	// The signal at amplitude 0.5 is -6 dBFS, less 0.6 dB in the channel
+	// filter.  The noise is added to I and Q and the filter keeps about a
+	// sixth of its power.
+	noise := dsp.Decibels(2 * m.Noise * m.Noise * 0.1654)
+	assert.InDelta(t, -6.6, msgs[0].RSSI, 0.3)
+	assert.InDelta(t, noise, msgs[0].Noise, 1)
+	assert.InDelta(t, -6.6-noise, msgs[0].SNR, 1)
+
+	m.Amplitude = 0.05
+	msgs = receive(transmission(m, Frame(temperature)))
+	require.Len(t, msgs, 1)
+	assert.InDelta(t, -26.6, msgs[0].RSSI, 0.5)
+}
+
+func TestRepair(t *testing.T) {
+	p := protocol.NewParser(14, "US")
+	m := NewModulator(&p.Cfg, 1)
+	damaged := Frame(temperature)
+	damaged[3] ^= 0x10
+	iq := transmission(m, damaged)
+
+	parse := func(repair int) []protocol.Message {
+		p := protocol.NewParser(14, "US")
+		p.SetRepair(repair)
+		var msgs []protocol.Message
+		for buf := iq; len(buf) >= p.Cfg.BlockSize2; buf = buf[p.Cfg.BlockSize2:] {
+			msgs = append(msgs, p.Parse(p.Demodulate(buf[:p.Cfg.BlockSize2]))...)
+		}
+		return msgs
+	}
+
+	assert.Empty(t, parse(0))
+	msgs := parse(1)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, temperature, msgs[0].Data)
+	assert.Equal(t, 1, msgs[0].Repaired)
+
+	msgs = receive(transmission(m, Frame(temperature)))
+	require.Len(t, msgs, 1)
+	assert.Equal(t, 0, msgs[0].Repaired)
+}
@@ -0,0 +1,216 @@
+package sim
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/scheduler"
+	"github.com/nathanmsmith/rtldavis/source"
+)
+
+// DefaultMessageTypes is the order in which a simulated ISS sends its
+// sensor readings: temperature, rain and rain rate every 10 seconds, the
+// rest about every 40 seconds.
+var DefaultMessageTypes = []byte{0x8, 0xE, 0x5, 0x2, 0x8, 0xE, 0x5, 0x7, 0x8, 0xE, 0x5, 0xA, 0x8, 0xE, 0x5, 0x9}
+
+// Transmitter is a simulated ISS.  It sends a packet every
+// scheduler.LoopPeriod(ID), each on the next channel of the hop sequence.
+type Transmitter struct {
+	ID int
+	// Seq is the hop sequence position of the next packet.
+	Seq int
+	// Next is the stream time of the next packet.
+	Next time.Duration
+	// Types are the message types to cycle through.
+	Types []byte
+	// FreqOffset is how far the transmitter's crystal is off, in Hz.
+	FreqOffset float64
+	// Off stops the transmitter from sending, while it keeps hopping.
+	Off bool
+
+	// Sent counts the packets transmitted and Heard those that went out
+	// on the channel the receiver was tuned to.
+	Sent, Heard int
+
+	count int
+}
+
+// NewTransmitter returns a transmitter that sends its first packet at
+// stream time start on hop sequence position seq.
+func NewTransmitter(id, seq int, start time.Duration) *Transmitter {
+	return &Transmitter{ID: id, Seq: seq, Next: start, Types: DefaultMessageTypes}
+}
+
+// Message returns the data of the next packet, checksum included.
+// Wind speed counts up and the sensor bytes hold fixed plausible values.
+func (t *Transmitter) Message() []byte {
+	msgType := t.Types[t.count%len(t.Types)]
+	data := []byte{msgType<<4 | byte(t.ID), byte(t.count % 40), 0x80, 0, 0, 0}
+	switch msgType {
+	case 0x2, 0x7: // supercap and solar panel voltage: 2.8 V
+		data[3], data[4] = 0xD2, 0x00
+	case 0x5: // rain rate: no rain
+		data[3], data[4] = 0xFF, 0x71
+	case 0x8: // temperature: 72.0 F, digital sensor
+		data[3], data[4] = 0x2D, 0x08
+	case 0x9: // gust: 12 mph
+		data[3], data[5] = 12, 0x30
+	case 0xA: // humidity: 55.0 %, digital sensor
+		data[3], data[4] = 0x26, 0x2B
+	case 0xE: // rain clicks
+		data[3] = byte(t.count/16) & 0x7F
+	}
+	return Frame(data)
+}
+
+// Source is a source.SampleSource fed by simulated transmitters.  Time is
+// measured in samples read, so the simulation runs as fast as the
+// receiver consumes samples.
+type Source struct {
+	// Epoch is the wall clock time of the first sample.
+	Epoch time.Time
+	// Noise level of the channel; see Modulator.Noise.
+	Noise float64
+
+	parser       protocol.Parser
+	transmitters []*Transmitter
+	mod          *Modulator
+
+	mutex   sync.Mutex
+	samples int64  // samples read so far
+	tuned   int    // center frequency in Hz
+	burst   []byte // samples of the packet on the air
+}
+
+var _ source.SampleSource = (*Source)(nil)
+
+// NewSource returns a source for the given transmitter frequencies (EU, US
+// or NZ) with the transmitters on the air.
+func NewSource(tf string, start time.Time, transmitters ...*Transmitter) *Source {
+	s := &Source{
+		Epoch:        start,
+		Noise:        0.01,
+		parser:       protocol.NewParser(14, tf),
+		transmitters: transmitters,
+	}
+	s.mod = NewModulator(&s.parser.Cfg, 1)
+	return s
+}
+
+// Now returns the stream time of the next sample to be read.
+func (s *Source) Now() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.Epoch.Add(s.elapsed())
+}
+
+func (s *Source) elapsed() time.Duration {
+	return time.Duration(s.samples) * time.Second / time.Duration(s.parser.Cfg.SampleRate)
+}
+
+// Read fills p with samples.  Packets sent while the receiver is tuned to
+// the transmitter's channel are modulated into the stream; the rest are lost.
+func (s *Source) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := len(p) &^ 1
+	for off := 0; off < n; {
+		if len(s.burst) == 0 {
+			s.transmit()
+		}
+		var chunk []byte
+		if len(s.burst) > 0 {
+			chunk = s.burst
+		} else {
+			chunk = s.silence(n - off)
+		}
+		c := copy(p[off:n], chunk)
+		if len(s.burst) > 0 {
+			s.burst = s.burst[c:]
+		}
+		off += c
+		s.samples += int64(c / 2)
+	}
+	return n, nil
+}
+
+// transmit starts the burst of any transmitter whose packet is due.
+func (s *Source) transmit() {
+	now := s.elapsed()
+	for _, t := range s.transmitters {
+		for t.Next <= now {
+			freq := s.parser.SetHop(t.Seq, 0).ChannelFreq
+			msg := t.Message()
+			t.Seq = (t.Seq + 1) % s.parser.ChannelCount
+			t.Next += scheduler.LoopPeriod(t.ID)
+			t.count++
+			if t.Off {
+				continue
+			}
+			t.Sent++
+
+			offset := float64(freq-s.tuned) + t.FreqOffset
+			if len(s.burst) > 0 || math.Abs(offset) > float64(s.parser.Cfg.SampleRate)/4 {
+				continue
+			}
+			t.Heard++
+			s.mod.FreqOffset = offset
+			s.mod.Noise = s.Noise
+			s.burst = s.mod.Modulate(msg)
+		}
+	}
+}
+
+// silence returns up to n bytes of noise, stopping at the next packet.
+func (s *Source) silence(n int) []byte {
+	now := s.elapsed()
+	sampleRate := time.Duration(s.parser.Cfg.SampleRate)
+	for _, t := range s.transmitters {
+		until := int((t.Next-now)*sampleRate/time.Second) + 1
+		if until*2 < n {
+			n = until * 2
+		}
+	}
+	s.mod.Noise = s.Noise
+	return s.mod.Silence(n / 2)
+}
+
+// Tuned returns the frequency the receiver is listening on.
+func (s *Source) Tuned() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.tuned
+}
+
+func (s *Source) SetCenterFreq(freq int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tuned = freq
+	return nil
+}
+
+func (s *Source) SetSampleRate(rate int) error {
+	return nil
+}
+
+func (s *Source) SetTunerGain(gain int) error {
+	return nil
+}
+
+func (s *Source) SetFreqCorrection(ppm int) error {
+	return nil
+}
+
+func (s *Source) Start(blockSize int) error {
+	return nil
+}
+
+func (s *Source) Close() error {
+	return nil
+}
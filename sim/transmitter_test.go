@@ -0,0 +1,156 @@
+package sim
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/crc"
+	"github.com/nathanmsmith/rtldavis/protocol"
+	"github.com/nathanmsmith/rtldavis/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var epoch = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// receiver runs the hop loop of main against a simulated source.
+type receiver struct {
+	src    *Source
+	parser protocol.Parser
+	sched  *scheduler.HopScheduler
+	step   scheduler.Step
+	msgs   []protocol.Message
+}
+
+func newReceiver(src *Source, tf string, transmitters, maxMissed int) *receiver {
+	r := &receiver{src: src, parser: protocol.NewParser(14, tf)}
+	r.sched = scheduler.New(scheduler.Config{
+		Transmitters:  transmitters,
+		ChannelCount:  r.parser.ChannelCount,
+		MaxMissed:     maxMissed,
+		ReceiveWindow: 300 * time.Millisecond,
+	}, &r.parser)
+	r.tune(r.sched.Start(src.Now()))
+	return r
+}
+
+func (r *receiver) tune(step scheduler.Step) {
+	r.step = step
+	_ = r.src.SetCenterFreq(step.Hop.ChannelFreq + step.Hop.FreqCorr)
+}
+
+// run receives for d of stream time.
+func (r *receiver) run(t *testing.T, d time.Duration) {
+	block := make([]byte, r.parser.Cfg.BlockSize2)
+	for end := r.src.Now().Add(d); r.src.Now().Before(end); {
+		if !r.src.Now().Before(r.step.Deadline) {
+			r.tune(r.sched.OnTimeout(r.src.Now()))
+			continue
+		}
+		_, err := io.ReadFull(r.src, block)
+		require.NoError(t, err)
+
+		var next *scheduler.Step
+		for _, msg := range r.parser.Parse(r.parser.Demodulate(block)) {
+			kind, step := r.sched.OnPacket(msg, r.step.Hop.ChannelIdx, r.src.Now())
+			if step != nil {
+				next = step
+			}
+			if kind == scheduler.Syncing || kind == scheduler.InSync {
+				r.msgs = append(r.msgs, msg)
+			}
+		}
+		if next != nil {
+			r.tune(*next)
+		}
+	}
+}
+
+func TestTransmitterMessage(t *testing.T) {
+	tx := NewTransmitter(3, 0, 0)
+	c := crc.NewCRC("CCITT-16", 0, 0x1021, 0)
+	for i, msgType := range DefaultMessageTypes {
+		data := tx.Message()
+		tx.count++
+		require.Len(t, data, 8)
+		assert.Equal(t, msgType, data[0]>>4, "message %d", i)
+		assert.Equal(t, byte(3), data[0]&7)
+		assert.Equal(t, uint16(0), c.Checksum(data))
+	}
+}
+
+func TestSourceClock(t *testing.T) {
+	src := NewSource("EU", epoch)
+	buf := make([]byte, 2*268800)
+	n, err := src.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, epoch.Add(time.Second), src.Now())
+}
+
+func TestFollowsTransmitter(t *testing.T) {
+	tx := NewTransmitter(0, 0, 500*time.Millisecond)
+	tx.FreqOffset = 3000
+	src := NewSource("EU", epoch, tx)
+	r := newReceiver(src, "EU", 1, 4)
+
+	r.run(t, 30*time.Second)
+	assert.True(t, r.sched.Synchronized())
+	assert.Equal(t, 12, tx.Sent)
+	assert.Equal(t, tx.Sent, tx.Heard, "the receiver is on the right channel for every packet")
+	require.Len(t, r.msgs, tx.Sent)
+	assert.Equal(t, []int{0}, r.sched.Stats().MissedInARow)
+	assert.Equal(t, 0, r.sched.Stats().Inits)
+	for _, msg := range r.msgs {
+		assert.Equal(t, byte(0), msg.ID)
+	}
+	// The first packet is heard without frequency correction; after that
+	// the correction slowly takes up the transmitter's offset.
+	assert.InDelta(t, 3000, r.msgs[0].FreqError, 500)
+	assert.Less(t, r.msgs[len(r.msgs)-1].FreqError, r.msgs[0].FreqError-300)
+}
+
+func TestLostSyncRestartsAndResyncs(t *testing.T) {
+	tx := NewTransmitter(1, 0, 500*time.Millisecond)
+	src := NewSource("EU", epoch, tx)
+	r := newReceiver(src, "EU", 2, 2)
+
+	r.run(t, 10*time.Second)
+	require.True(t, r.sched.Synchronized())
+	heard := len(r.msgs)
+
+	// The transmitter goes quiet: after MaxMissed packets the scheduler
+	// starts over on the first channel.
+	tx.Off = true
+	r.run(t, 4*scheduler.LoopPeriod(1))
+	assert.False(t, r.sched.Synchronized())
+	assert.Equal(t, 1, r.sched.Stats().Inits)
+	assert.Equal(t, heard, len(r.msgs))
+
+	// It comes back and is found within one turn of the hop pattern.
+	tx.Off = false
+	r.run(t, 7*scheduler.LoopPeriod(1))
+	assert.True(t, r.sched.Synchronized())
+	assert.Greater(t, len(r.msgs), heard)
+
+	heard = len(r.msgs)
+	r.run(t, 10*scheduler.LoopPeriod(1))
+	assert.Equal(t, heard+10, len(r.msgs))
+	assert.Equal(t, []int{0}, r.sched.Stats().MissedInARow)
+}
+
+func TestFollowsTwoTransmitters(t *testing.T) {
+	// ID 2 starts a packet before ID 0, so both are first heard on channel 0.
+	tx0 := NewTransmitter(0, 0, 500*time.Millisecond)
+	tx2 := NewTransmitter(2, 4, 1500*time.Millisecond)
+	src := NewSource("EU", epoch, tx0, tx2)
+	r := newReceiver(src, "EU", 1|4, 4)
+
+	r.run(t, 40*time.Second)
+	require.True(t, r.sched.Synchronized())
+	messages := r.sched.Stats().Messages
+	assert.GreaterOrEqual(t, messages[0], tx0.Sent-1)
+	assert.GreaterOrEqual(t, messages[1], tx2.Sent-2)
+	assert.Equal(t, []int{0, 0}, r.sched.Stats().MissedInARow)
+}
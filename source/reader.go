@@ -0,0 +1,71 @@
+package source
+
+import (
+	"io"
+	"os"
+)
+
+// ReaderSource serves samples from any io.Reader, such as a .cu8 capture
+// made with rtl_sdr.  Tuning commands cannot change what is in the
+// stream, so they are only recorded.
+type ReaderSource struct {
+	r io.Reader
+	c io.Closer
+
+	CenterFreq  int
+	SampleRate  int
+	Gain        int
+	FreqCorrPPM int
+	BlockSize   int
+}
+
+func NewReaderSource(r io.Reader) *ReaderSource {
+	return &ReaderSource{r: r}
+}
+
+// OpenFile returns a ReaderSource reading samples from the named file.
+func OpenFile(name string) (*ReaderSource, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := NewReaderSource(f)
+	s.c = f
+	return s, nil
+}
+
+func (s *ReaderSource) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *ReaderSource) SetCenterFreq(freq int) error {
+	s.CenterFreq = freq
+	return nil
+}
+
+func (s *ReaderSource) SetSampleRate(rate int) error {
+	s.SampleRate = rate
+	return nil
+}
+
+func (s *ReaderSource) SetTunerGain(gain int) error {
+	s.Gain = gain
+	return nil
+}
+
+func (s *ReaderSource) SetFreqCorrection(ppm int) error {
+	s.FreqCorrPPM = ppm
+	return nil
+}
+
+func (s *ReaderSource) Start(blockSize int) error {
+	s.BlockSize = blockSize
+	return nil
+}
+
+func (s *ReaderSource) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
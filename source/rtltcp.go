@@ -0,0 +1,116 @@
+package source
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// rtl_tcp commands.  Each is sent as one command byte followed by a
+// big-endian 32-bit parameter.
+const (
+	rtltcpSetFreq           = 0x01
+	rtltcpSetSampleRate     = 0x02
+	rtltcpSetGainMode       = 0x03
+	rtltcpSetGain           = 0x04
+	rtltcpSetFreqCorrection = 0x05
+)
+
+// RTLTCPSource reads samples from an rtl_tcp server, so the dongle can sit
+// near the antenna while the receiver runs elsewhere.
+type RTLTCPSource struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// Sent by the server when we connect.
+	TunerType uint32
+	GainCount uint32
+
+	// Commands are issued by the hop goroutine while the receive loop
+	// reads, and by the setup code before that.
+	mutex sync.Mutex
+}
+
+// DialRTLTCP connects to the rtl_tcp server at addr (host:port) and reads
+// its dongle info header.
+func DialRTLTCP(addr string) (*RTLTCPSource, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RTLTCPSource{conn: conn, r: bufio.NewReaderSize(conn, 64*1024)}
+
+	var header [12]byte
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err := io.ReadFull(s.r, header[:]); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("reading rtl_tcp header: %w", err)
+	}
+	if string(header[0:4]) != "RTL0" {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s is not an rtl_tcp server (magic %q)", addr, header[0:4])
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	s.TunerType = binary.BigEndian.Uint32(header[4:8])
+	s.GainCount = binary.BigEndian.Uint32(header[8:12])
+
+	return s, nil
+}
+
+func (s *RTLTCPSource) command(cmd byte, param uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var buf [5]byte
+	buf[0] = cmd
+	binary.BigEndian.PutUint32(buf[1:], param)
+	_, err := s.conn.Write(buf[:])
+	return err
+}
+
+func (s *RTLTCPSource) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *RTLTCPSource) SetCenterFreq(freq int) error {
+	return s.command(rtltcpSetFreq, uint32(freq))
+}
+
+func (s *RTLTCPSource) SetSampleRate(rate int) error {
+	return s.command(rtltcpSetSampleRate, uint32(rate))
+}
+
+func (s *RTLTCPSource) SetTunerGain(gain int) error {
+	if gain == 0 {
+		return s.command(rtltcpSetGainMode, 0)
+	}
+	if err := s.command(rtltcpSetGainMode, 1); err != nil {
+		return err
+	}
+	return s.command(rtltcpSetGain, uint32(gain))
+}
+
+func (s *RTLTCPSource) SetFreqCorrection(ppm int) error {
+	// Negative corrections travel as two's complement, as in rtl_tcp itself.
+	return s.command(rtltcpSetFreqCorrection, uint32(int32(ppm)))
+}
+
+// Start is a no-op; the server streams from the moment we connect.
+func (s *RTLTCPSource) Start(blockSize int) error {
+	return nil
+}
+
+func (s *RTLTCPSource) Close() error {
+	return s.conn.Close()
+}
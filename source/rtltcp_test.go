@@ -0,0 +1,104 @@
+package source
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rtltcpCommand struct {
+	cmd   byte
+	param uint32
+}
+
+// fakeRTLTCP is a minimal rtl_tcp stand-in.  It sends the dongle info
+// header and the given samples, then reports every command it receives.
+func fakeRTLTCP(t *testing.T, samples []byte) (addr string, commands <-chan rtltcpCommand) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	ch := make(chan rtltcpCommand, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		header := []byte{'R', 'T', 'L', '0', 0, 0, 0, 5, 0, 0, 0, 29}
+		if _, err := conn.Write(append(header, samples...)); err != nil {
+			return
+		}
+
+		var buf [5]byte
+		for {
+			if _, err := io.ReadFull(conn, buf[:]); err != nil {
+				close(ch)
+				return
+			}
+			ch <- rtltcpCommand{buf[0], binary.BigEndian.Uint32(buf[1:])}
+		}
+	}()
+
+	return ln.Addr().String(), ch
+}
+
+func TestRTLTCPSource(t *testing.T) {
+	samples := []byte{127, 128, 0, 255, 10, 20, 30, 40}
+	addr, commands := fakeRTLTCP(t, samples)
+
+	s, err := DialRTLTCP(addr)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), s.TunerType)
+	assert.Equal(t, uint32(29), s.GainCount)
+
+	require.NoError(t, s.SetSampleRate(268800))
+	require.NoError(t, s.SetCenterFreq(902419338))
+	require.NoError(t, s.SetTunerGain(0))
+	require.NoError(t, s.SetTunerGain(496))
+	require.NoError(t, s.SetFreqCorrection(-3))
+	require.NoError(t, s.Start(8))
+
+	block := make([]byte, len(samples))
+	_, err = io.ReadFull(s, block)
+	require.NoError(t, err)
+	assert.Equal(t, samples, block)
+
+	require.NoError(t, s.Close())
+
+	var got []rtltcpCommand
+	for c := range commands {
+		got = append(got, c)
+	}
+	assert.Equal(t, []rtltcpCommand{
+		{rtltcpSetSampleRate, 268800},
+		{rtltcpSetFreq, 902419338},
+		{rtltcpSetGainMode, 0},
+		{rtltcpSetGainMode, 1},
+		{rtltcpSetGain, 496},
+		{rtltcpSetFreqCorrection, 0xFFFFFFFD},
+	}, got)
+}
+
+func TestDialRTLTCPRejectsOtherServers(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("HTTP/1.1 400"))
+	}()
+
+	_, err = DialRTLTCP(ln.Addr().String())
+	assert.ErrorContains(t, err, "is not an rtl_tcp server")
+}
@@ -0,0 +1,34 @@
+/*
+Package source abstracts where rtldavis gets its IQ samples from.
+
+The receiver only needs a stream of unsigned 8-bit interleaved IQ samples
+(the format written by rtl_sdr, usually saved as .cu8) and a handful of
+tuning controls.  Keeping those behind an interface lets the hop logic,
+demodulator and decoders run against a USB dongle, a file, a network
+stream or a synthetic generator alike.
+
+The librtlsdr backend lives in package main so that this package, and
+everything that depends on it, builds without cgo.
+*/
+package source
+
+import "io"
+
+// A SampleSource delivers unsigned 8-bit IQ samples and accepts the
+// tuning commands issued while hopping.  Frequencies are in Hz, the gain
+// is in tenths of a dB and the frequency correction is in ppm.
+type SampleSource interface {
+	io.Reader
+
+	SetCenterFreq(freq int) error
+	SetSampleRate(rate int) error
+	// SetTunerGain selects manual gain; a gain of 0 selects automatic gain.
+	SetTunerGain(gain int) error
+	SetFreqCorrection(ppm int) error
+
+	// Start begins streaming.  Reads return blocks of at most blockSize
+	// bytes, so callers should use io.ReadFull to get whole blocks.
+	Start(blockSize int) error
+
+	Close() error
+}
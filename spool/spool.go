@@ -0,0 +1,162 @@
+// Package spool keeps a queue of payloads in a directory, one file each, so
+// that they survive restarts until they are delivered.
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ext = ".json"
+
+type entry struct {
+	seq  uint64
+	size int64
+}
+
+// Queue is a first in, first out queue of payloads on disk.  When the
+// payloads take more than MaxBytes, the oldest are dropped.
+type Queue struct {
+	Dir      string
+	MaxBytes int64
+
+	mutex   sync.Mutex
+	entries []entry
+	size    int64
+	next    uint64
+	dropped int
+}
+
+// Open opens the queue in dir, creating dir if needed.  Payloads left by an
+// earlier run are kept.
+func Open(dir string, maxBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Queue{Dir: dir, MaxBytes: maxBytes}
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// Left over from a crash while writing.
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.entries = append(q.entries, entry{seq, info.Size()})
+		q.size += info.Size()
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	return q, nil
+}
+
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.Dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+// Push adds a payload at the end of the queue.
+func (q *Queue) Push(payload []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	seq := q.next
+	tmp := q.path(seq) + ".tmp"
+	if err := os.WriteFile(tmp, payload, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, q.path(seq)); err != nil {
+		return err
+	}
+	q.next++
+	q.entries = append(q.entries, entry{seq, int64(len(payload))})
+	q.size += int64(len(payload))
+
+	for q.MaxBytes > 0 && q.size > q.MaxBytes && len(q.entries) > 1 {
+		if err := q.remove(q.entries[0].seq); err != nil {
+			return err
+		}
+		q.dropped++
+	}
+	return nil
+}
+
+// Peek returns the payload at the front of the queue and its ID, or false
+// if the queue is empty.
+func (q *Queue) Peek() (uint64, []byte, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.entries) == 0 {
+		return 0, nil, false, nil
+	}
+	seq := q.entries[0].seq
+	payload, err := os.ReadFile(q.path(seq))
+	return seq, payload, true, err
+}
+
+// Remove removes the payload with the given ID.
+func (q *Queue) Remove(id uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.remove(id)
+}
+
+func (q *Queue) remove(seq uint64) error {
+	for i, e := range q.entries {
+		if e.seq != seq {
+			continue
+		}
+		if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		q.entries = append(q.entries[:i], q.entries[i+1:]...)
+		q.size -= e.size
+		return nil
+	}
+	return nil
+}
+
+// Len returns the number of payloads in the queue.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.entries)
+}
+
+// Size returns the size of the payloads in the queue in bytes.
+func (q *Queue) Size() int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.size
+}
+
+// Dropped returns how many payloads were dropped to stay under MaxBytes.
+func (q *Queue) Dropped() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.dropped
+}
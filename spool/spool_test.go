@@ -0,0 +1,78 @@
+package spool
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOrder(t *testing.T) {
+	q, err := Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	_, _, ok, err := q.Peek()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, p := range []string{"a", "bb", "ccc"} {
+		require.NoError(t, q.Push([]byte(p)))
+	}
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, int64(6), q.Size())
+
+	for _, want := range []string{"a", "bb", "ccc"} {
+		id, payload, ok, err := q.Peek()
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, want, string(payload))
+		require.NoError(t, q.Remove(id))
+	}
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, int64(0), q.Size())
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, q.Push([]byte("first")))
+	require.NoError(t, q.Push([]byte("second")))
+	require.NoError(t, os.WriteFile(dir+"/00000000000000000009.json.tmp", []byte("partial"), 0o644))
+
+	q, err = Open(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.Len())
+	require.NoError(t, q.Push([]byte("third")))
+
+	var got []string
+	for {
+		id, payload, ok, err := q.Peek()
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+		got = append(got, string(payload))
+		require.NoError(t, q.Remove(id))
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, got)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "delivered and partial payloads are deleted")
+}
+
+func TestQueueDropsOldest(t *testing.T) {
+	q, err := Open(t.TempDir(), 10)
+	require.NoError(t, err)
+	for _, p := range []string{"1111", "2222", "3333", "4444"} {
+		require.NoError(t, q.Push([]byte(p)))
+	}
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, 2, q.Dropped())
+
+	_, payload, _, err := q.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "3333", string(payload))
+}
@@ -0,0 +1,146 @@
+/*
+Package vantage emulates the serial protocol of a Davis Vantage console
+on a TCP port, so that software written for a console on a serial to
+network adapter, like the weewx Vantage driver, can read the data rtldavis
+decodes.
+
+The protocol is described in Davis' "Vantage Pro, Vantage Pro2 and
+Vantage Vue Serial Communication Reference Manual".  Only the commands
+such software needs to find the console and stream LOOP and LOOP2
+packets are implemented.  Values the ISS doesn't send, such as the inside
+temperature and the barometer, are sent as "dashed", the console's way of
+saying there is no sensor.
+*/
+package vantage
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/nathanmsmith/rtldavis/crc"
+	"github.com/nathanmsmith/rtldavis/processor"
+)
+
+// LoopLength is the length of LOOP and LOOP2 packets, CRC included.
+const LoopLength = 99
+
+// Dashed values.
+const (
+	dashed8  = 0xFF
+	dashed16 = 0x7FFF
+)
+
+// ccitt is the CRC of the serial protocol, the same as the radio's: the
+// CRC of a block followed by its CRC, high byte first, is zero.
+var ccitt = crc.NewCRC("CCITT-16", 0, 0x1021, 0)
+
+func appendCRC(b []byte) []byte {
+	return binary.BigEndian.AppendUint16(b, ccitt.Checksum(b))
+}
+
+func put16(b []byte, off int, v int) {
+	binary.LittleEndian.PutUint16(b[off:], uint16(v))
+}
+
+func fill(b []byte, from, to int, v byte) {
+	for i := from; i < to; i++ {
+		b[i] = v
+	}
+}
+
+// clicks converts inches of rain to bucket tips.
+func clicks(inches float32) int {
+	return int(math.Round(float64(inches) / processor.RainPerClick))
+}
+
+// newLoop returns a packet of the given type, 0 for LOOP and 1 for LOOP2,
+// with the fields both types share.
+func newLoop(packetType byte, data processor.WeatherDatum) []byte {
+	b := make([]byte, LoopLength-2)
+	copy(b, "LOO")
+	b[3] = 'P' // no barometer, so no trend
+	b[4] = packetType
+	// 7-8 barometer: 0 when there is none
+	put16(b, 9, dashed16) // inside temperature
+	b[11] = dashed8       // inside humidity
+	put16(b, 12, dashed16)
+	if t := data.Temperature; t != nil {
+		put16(b, 12, int(math.Round(float64(t.Value)*10)))
+	}
+	if w := data.Wind; w != nil {
+		b[14] = byte(w.Speed)
+		put16(b, 16, (int(w.Direction)+359)%360+1)
+	}
+	b[33] = dashed8
+	if h := data.Humidity; h != nil {
+		b[33] = byte(math.Round(float64(h.Value)))
+	}
+	if r := data.RainRate; r != nil {
+		put16(b, 41, clicks(r.InchesPerHour))
+	}
+	b[43] = dashed8
+	if u := data.UV; u != nil {
+		b[43] = byte(math.Round(float64(u.Value) * 10))
+	}
+	put16(b, 44, dashed16)
+	if s := data.SolarRadiation; s != nil {
+		put16(b, 44, int(s.Value))
+	}
+	put16(b, 48, 0xFFFF) // no storm
+	if r := data.RainTotals; r != nil {
+		put16(b, 50, clicks(r.Daily))
+	}
+	b[95], b[96] = '\n', '\r'
+	return b
+}
+
+// Loop returns a LOOP packet of data.
+func Loop(data processor.WeatherDatum) []byte {
+	b := newLoop(0, data)
+	if w := data.PeakWind; w != nil {
+		b[15] = byte(math.Round(float64(w.Average)))
+	}
+	fill(b, 18, 33, dashed8) // extra, soil and leaf temperatures
+	fill(b, 34, 41, dashed8) // extra humidities
+	fill(b, 62, 70, dashed8) // soil moistures and leaf wetnesses
+	if d := data.Battery; d != nil && d.IsLow {
+		b[86] = 1 << (d.Transmitter & 7)
+	}
+	put16(b, 87, 470*512/300) // console battery at 4.7 V: raw*300/512/100
+	return appendCRC(b)
+}
+
+// Loop2 returns a LOOP2 packet of data.
+func Loop2(data processor.WeatherDatum) []byte {
+	b := newLoop(1, data)
+	put16(b, 5, dashed16)
+	b[15] = dashed8
+	if w := data.PeakWind; w != nil {
+		// The ISS only gives the 10 minute average; use it for the
+		// 2 minute one too.
+		put16(b, 18, int(math.Round(float64(w.Average)*10)))
+		put16(b, 20, int(math.Round(float64(w.Average)*10)))
+		put16(b, 22, int(w.Speed))
+		put16(b, 24, (int(w.Direction)+359)%360+1)
+	}
+	put16(b, 26, dashed16)
+	put16(b, 28, dashed16)
+	put16(b, 30, dashed16)
+	if d := data.DewPoint; d != nil {
+		put16(b, 30, int(math.Round(float64(d.Value))))
+	}
+	b[32] = dashed8
+	b[34] = dashed8
+	put16(b, 35, dashed16) // heat index
+	put16(b, 37, dashed16) // wind chill
+	put16(b, 39, dashed16) // THSW index
+	if r := data.RainTotals; r != nil {
+		put16(b, 54, clicks(r.LastHour))
+		put16(b, 58, clicks(r.Last24h))
+	}
+	fill(b, 71, 73, dashed8)
+	for off := 83; off < 95; off += 2 {
+		put16(b, off, dashed16)
+	}
+	return appendCRC(b)
+}
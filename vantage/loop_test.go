@@ -0,0 +1,89 @@
+package vantage
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/nathanmsmith/rtldavis/processor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var data = processor.WeatherDatum{
+	Temperature: &processor.TemperatureDatum{Value: -3.4},
+	Humidity:    &processor.HumidityDatum{Value: 87.6},
+	Wind:        &processor.WindDatum{Speed: 7, Direction: 0},
+	PeakWind:    &processor.PeakWindDatum{Speed: 15, Direction: 225, Average: 5.26},
+	RainRate:    &processor.RainRateDatum{InchesPerHour: 0.24},
+	RainTotals:  &processor.RainTotalsDatum{Daily: 0.42, LastHour: 0.1, Last24h: 0.5},
+	DewPoint:    &processor.DewPointDatum{Value: -6.3},
+	Battery:     &processor.BatteryDatum{IsLow: true, Transmitter: 1},
+}
+
+func u16(b []byte, off int) uint16 {
+	return binary.LittleEndian.Uint16(b[off:])
+}
+
+func i16(b []byte, off int) int16 {
+	return int16(u16(b, off))
+}
+
+func TestLoop(t *testing.T) {
+	b := Loop(data)
+	require.Len(t, b, LoopLength)
+	assert.Equal(t, "LOO", string(b[:3]))
+	assert.Equal(t, byte(0), b[4])
+	assert.Equal(t, uint16(0), ccitt.Checksum(b), "CRC")
+	assert.Equal(t, "\n\r", string(b[95:97]))
+
+	assert.Equal(t, uint16(0), u16(b, 7), "no barometer")
+	assert.Equal(t, uint16(dashed16), u16(b, 9), "no inside temperature")
+	assert.Equal(t, int16(-34), i16(b, 12))
+	assert.Equal(t, byte(7), b[14])
+	assert.Equal(t, byte(5), b[15])
+	assert.Equal(t, uint16(360), u16(b, 16), "north is 360, 0 means no wind direction")
+	assert.Equal(t, byte(dashed8), b[18])
+	assert.Equal(t, byte(88), b[33])
+	assert.Equal(t, uint16(24), u16(b, 41))
+	assert.Equal(t, byte(dashed8), b[43], "no UV sensor")
+	assert.Equal(t, uint16(42), u16(b, 50))
+	assert.Equal(t, byte(2), b[86], "transmitter 1 battery low")
+	assert.Equal(t, uint16(802), u16(b, 87), "console battery")
+	assert.InDelta(t, 4.7, float64(u16(b, 87))*300/512/100, 0.01)
+
+	assert.Equal(t, uint16(dashed16), u16(b, 44), "no solar radiation sensor")
+
+	b = Loop(processor.WeatherDatum{
+		UV:             &processor.UVDatum{Value: 6.3},
+		SolarRadiation: &processor.SolarRadiationDatum{Value: 812},
+	})
+	assert.Equal(t, byte(63), b[43], "UV index in tenths")
+	assert.Equal(t, uint16(812), u16(b, 44))
+}
+
+func TestLoop2(t *testing.T) {
+	b := Loop2(data)
+	require.Len(t, b, LoopLength)
+	assert.Equal(t, byte(1), b[4])
+	assert.Equal(t, uint16(0), ccitt.Checksum(b), "CRC")
+	assert.Equal(t, "\n\r", string(b[95:97]))
+
+	assert.Equal(t, int16(-34), i16(b, 12))
+	assert.Equal(t, uint16(53), u16(b, 18))
+	assert.Equal(t, uint16(53), u16(b, 20))
+	assert.Equal(t, uint16(15), u16(b, 22))
+	assert.Equal(t, uint16(225), u16(b, 24))
+	assert.Equal(t, int16(-6), i16(b, 30))
+	assert.Equal(t, uint16(dashed16), u16(b, 37), "no wind chill")
+	assert.Equal(t, uint16(42), u16(b, 50))
+	assert.Equal(t, uint16(10), u16(b, 54))
+	assert.Equal(t, uint16(50), u16(b, 58))
+}
+
+func TestLoopWithoutData(t *testing.T) {
+	b := Loop(processor.WeatherDatum{})
+	assert.Equal(t, uint16(dashed16), u16(b, 12))
+	assert.Equal(t, uint16(0), u16(b, 16))
+	assert.Equal(t, byte(dashed8), b[33])
+	assert.Equal(t, uint16(0), ccitt.Checksum(b))
+}
@@ -0,0 +1,307 @@
+package vantage
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/processor"
+)
+
+// Response bytes.
+const (
+	ack = 0x06
+	nak = 0x21
+)
+
+// Station types answered to WRD.
+const (
+	VantagePro2 = 16
+	VantageVue  = 17
+)
+
+// EEPROM addresses software reads at startup.
+const (
+	eeUnitBits      = 0x29
+	eeUnitBitsComp  = 0x2A
+	eeArchivePeriod = 0x2D
+)
+
+// Server answers console commands on every connection it accepts.
+type Server struct {
+	// Latest returns the data to fill LOOP packets with.
+	Latest func() processor.WeatherDatum
+	// StationType is what WRD reports, VantagePro2 or VantageVue.
+	StationType byte
+	// LoopInterval is the time between LOOP packets, 2 seconds on a
+	// console.
+	LoopInterval time.Duration
+
+	eeprom [4096]byte
+
+	mutex  sync.Mutex
+	ln     net.Listener
+	closed bool
+	conns  map[net.Conn]bool
+	wg     sync.WaitGroup
+}
+
+func NewServer(latest func() processor.WeatherDatum, stationType byte) *Server {
+	s := &Server{
+		Latest:       latest,
+		StationType:  stationType,
+		LoopInterval: 2 * time.Second,
+		conns:        make(map[net.Conn]bool),
+	}
+	// US units and a 5 minute archive interval, the factory settings.
+	s.eeprom[eeUnitBitsComp] = ^s.eeprom[eeUnitBits]
+	s.eeprom[eeArchivePeriod] = 5
+	return s
+}
+
+// Serve accepts connections on ln until Close.  If Close came first, it
+// closes ln and returns net.ErrClosed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		_ = ln.Close()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mutex.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			s.mutex.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// their handlers.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// session is one connection.  A reader goroutine feeds what arrives to in,
+// so that a LOOP stream can be cancelled by any byte the client sends.
+type session struct {
+	conn net.Conn
+	in   chan []byte
+	done chan struct{}
+	buf  []byte
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{conn: conn, in: make(chan []byte), done: make(chan struct{})}
+	defer func() {
+		close(sess.done)
+		_ = conn.Close()
+	}()
+	go func() {
+		defer close(sess.in)
+		for {
+			b := make([]byte, 256)
+			n, err := conn.Read(b)
+			if n > 0 {
+				select {
+				case sess.in <- b[:n]:
+				case <-sess.done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		line, ok := sess.line()
+		if !ok {
+			return
+		}
+		if err := s.command(sess, line); err != nil {
+			log.Printf("Vantage console %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// fill waits for more input.
+func (sess *session) fill() bool {
+	b, ok := <-sess.in
+	sess.buf = append(sess.buf, b...)
+	return ok
+}
+
+// line returns the next command, without the line end.
+func (sess *session) line() (string, bool) {
+	for {
+		if i := bytes.IndexByte(sess.buf, '\n'); i >= 0 {
+			line := strings.TrimRight(string(sess.buf[:i]), "\r")
+			sess.buf = sess.buf[i+1:]
+			return line, true
+		}
+		if !sess.fill() {
+			return "", false
+		}
+	}
+}
+
+// read returns the next n bytes, for commands followed by binary data.
+func (sess *session) read(n int) ([]byte, error) {
+	for len(sess.buf) < n {
+		if !sess.fill() {
+			return nil, errors.New("connection closed")
+		}
+	}
+	b := sess.buf[:n]
+	sess.buf = sess.buf[n:]
+	return b, nil
+}
+
+func (sess *session) write(b ...byte) error {
+	_, err := sess.conn.Write(b)
+	return err
+}
+
+func (sess *session) text(lines ...string) error {
+	return sess.write([]byte("\n\r" + strings.Join(lines, "\n\r") + "\n\r")...)
+}
+
+// command answers one command line.
+func (s *Server) command(sess *session, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		// Wakeup.
+		return sess.write('\n', '\r')
+	}
+	args := fields[1:]
+	switch cmd := strings.ToUpper(fields[0]); {
+	case cmd == "TEST":
+		return sess.text("TEST")
+	case cmd == "VER":
+		return sess.text("OK", "Apr 10 2012")
+	case cmd == "NVER":
+		return sess.text("OK", "3.12")
+	case cmd == "RXCHECK":
+		return sess.text("OK", " 0 0 0 0 0")
+	case cmd == "LOOP" && len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return sess.write(nak)
+		}
+		return s.loop(sess, 1, n)
+	case cmd == "LPS" && len(args) == 2:
+		types, err1 := strconv.Atoi(args[0])
+		n, err2 := strconv.Atoi(args[1])
+		if err1 != nil || err2 != nil || types < 1 || types > 3 {
+			return sess.write(nak)
+		}
+		return s.loop(sess, types, n)
+	case strings.HasPrefix(cmd, "WRD"):
+		// WRD 0x12 0x4D asks for the station type.
+		if line != "WRD\x12\x4d" {
+			return sess.write(nak)
+		}
+		return sess.write(ack, s.StationType)
+	case cmd == "EEBRD" && len(args) == 2:
+		addr, err1 := strconv.ParseUint(args[0], 16, 16)
+		n, err2 := strconv.ParseUint(args[1], 16, 16)
+		if err1 != nil || err2 != nil || addr+n > uint64(len(s.eeprom)) {
+			return sess.write(nak)
+		}
+		return sess.write(append([]byte{ack}, appendCRC(append([]byte(nil), s.eeprom[addr:addr+n]...))...)...)
+	case cmd == "GETTIME":
+		now := time.Now()
+		t := []byte{byte(now.Second()), byte(now.Minute()), byte(now.Hour()),
+			byte(now.Day()), byte(now.Month()), byte(now.Year() - 1900)}
+		return sess.write(append([]byte{ack}, appendCRC(t)...)...)
+	case cmd == "SETTIME":
+		// The clock is the computer's; take the new time and ignore it.
+		if err := sess.write(ack); err != nil {
+			return err
+		}
+		if _, err := sess.read(8); err != nil {
+			return err
+		}
+		return sess.write(ack)
+	case cmd == "DMPAFT":
+		// There is no archive: take the date and answer with 0 pages.
+		if err := sess.write(ack); err != nil {
+			return err
+		}
+		if _, err := sess.read(6); err != nil {
+			return err
+		}
+		if err := sess.write(append([]byte{ack}, appendCRC([]byte{0, 0, 0, 0})...)...); err != nil {
+			return err
+		}
+		_, err := sess.read(1)
+		return err
+	}
+	return sess.write(nak)
+}
+
+// loop sends n packets, LOOP for types 1, LOOP2 for 2 and both in turn
+// for 3, until any input cancels it.
+func (s *Server) loop(sess *session, types, n int) error {
+	if err := sess.write(ack); err != nil {
+		return err
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	loop2 := types == 2
+	for i := 0; i < n; i++ {
+		select {
+		case <-sess.in:
+			// Cancelled; what was sent to cancel is dropped.
+			return nil
+		case <-timer.C:
+		}
+		packet := Loop(s.Latest())
+		if loop2 {
+			packet = Loop2(s.Latest())
+		}
+		if err := sess.write(packet...); err != nil {
+			return err
+		}
+		if types == 3 {
+			loop2 = !loop2
+		}
+		timer.Reset(s.LoopInterval)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package vantage
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/processor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// console starts a server and returns a connection to it.
+func console(t *testing.T) net.Conn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer(func() processor.WeatherDatum { return data }, VantageVue)
+	s.LoopInterval = 10 * time.Millisecond
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	return conn
+}
+
+func send(t *testing.T, conn net.Conn, s string) {
+	_, err := conn.Write([]byte(s))
+	require.NoError(t, err)
+}
+
+func expect(t *testing.T, conn net.Conn, n int) []byte {
+	b := make([]byte, n)
+	_, err := io.ReadFull(conn, b)
+	require.NoError(t, err)
+	return b
+}
+
+func TestServerCommands(t *testing.T) {
+	conn := console(t)
+
+	send(t, conn, "\n")
+	assert.Equal(t, "\n\r", string(expect(t, conn, 2)))
+	send(t, conn, "TEST\n")
+	assert.Equal(t, "\n\rTEST\n\r", string(expect(t, conn, 8)))
+	send(t, conn, "NVER\n")
+	assert.Equal(t, "\n\rOK\n\r3.12\n\r", string(expect(t, conn, 12)))
+	send(t, conn, "WRD\x12\x4d\n")
+	assert.Equal(t, []byte{ack, VantageVue}, expect(t, conn, 2))
+
+	send(t, conn, "EEBRD 2D 01\n")
+	b := expect(t, conn, 4)
+	assert.Equal(t, byte(ack), b[0])
+	assert.Equal(t, byte(5), b[1], "archive period")
+	assert.Equal(t, uint16(0), ccitt.Checksum(b[1:]))
+
+	send(t, conn, "GETTIME\n")
+	b = expect(t, conn, 9)
+	assert.Equal(t, byte(ack), b[0])
+	assert.Equal(t, uint16(0), ccitt.Checksum(b[1:]))
+
+	send(t, conn, "DMPAFT\n")
+	assert.Equal(t, []byte{ack}, expect(t, conn, 1))
+	send(t, conn, string(appendCRC([]byte{0x59, 0x32, 0x0c, 0x05})))
+	b = expect(t, conn, 7)
+	assert.Equal(t, []byte{ack, 0, 0, 0, 0}, b[:5], "no pages")
+	assert.Equal(t, uint16(0), ccitt.Checksum(b[1:]))
+	send(t, conn, string([]byte{ack}))
+
+	send(t, conn, "BOGUS\n")
+	assert.Equal(t, []byte{nak}, expect(t, conn, 1))
+}
+
+func TestServerLoop(t *testing.T) {
+	conn := console(t)
+
+	send(t, conn, "LPS 3 2\n")
+	assert.Equal(t, []byte{ack}, expect(t, conn, 1))
+	assert.Equal(t, Loop(data), expect(t, conn, LoopLength))
+	assert.Equal(t, Loop2(data), expect(t, conn, LoopLength))
+
+	send(t, conn, "LOOP 2\n")
+	assert.Equal(t, []byte{ack}, expect(t, conn, 1))
+	assert.Equal(t, Loop(data), expect(t, conn, LoopLength))
+	assert.Equal(t, Loop(data), expect(t, conn, LoopLength))
+}
+
+func TestServerLoopCancel(t *testing.T) {
+	conn := console(t)
+
+	send(t, conn, "LOOP 1000\n")
+	assert.Equal(t, []byte{ack}, expect(t, conn, 1))
+	expect(t, conn, LoopLength)
+	send(t, conn, "\n")
+
+	// Packets sent before the cancel arrived may follow; then the console
+	// is awake again.
+	time.Sleep(50 * time.Millisecond)
+	send(t, conn, "TEST\n")
+	var got []byte
+	for len(got) < 8 || string(got[len(got)-8:]) != "\n\rTEST\n\r" {
+		got = append(got, expect(t, conn, 1)...)
+	}
+	assert.Zero(t, (len(got)-8)%LoopLength, "only whole packets before the answer")
+}
+
+func TestServeAfterClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer(func() processor.WeatherDatum { return data }, VantageVue)
+	require.NoError(t, s.Close())
+
+	assert.ErrorIs(t, s.Serve(ln), net.ErrClosed)
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err, "the listener is closed")
+}
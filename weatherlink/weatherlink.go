@@ -0,0 +1,380 @@
+/*
+Package weatherlink emulates the local API of a WeatherLink Live, so that
+software written for one, such as Home Assistant integrations and
+weewx-weatherlink-live, can read the data rtldavis decodes.
+
+GET /v1/current_conditions answers with the latest readings.  GET
+/v1/real_time?duration=N starts UDP broadcasts of wind and rain every 2.5
+seconds for N seconds.  The JSON follows Davis' WeatherLink Live Local API
+documentation; values rtldavis does not have are null, as a WeatherLink
+Live sends them for a missing sensor.
+*/
+package weatherlink
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"github.com/nathanmsmith/rtldavis/processor"
+)
+
+// Data structure types of the conditions.
+const (
+	typeISS       = 1
+	typeBarometer = 3
+	typeInside    = 4
+)
+
+// rainSize01in says rain is counted in 0.01 in clicks.
+const rainSize01in = 1
+
+// ISSConditions is the current_conditions record of an ISS.  Rain is in
+// clicks of rain_size.
+type ISSConditions struct {
+	LSID              int64    `json:"lsid"`
+	DataStructureType int      `json:"data_structure_type"`
+	TxID              int      `json:"txid"`
+	Temp              *float64 `json:"temp"`
+	Hum               *float64 `json:"hum"`
+	DewPoint          *float64 `json:"dew_point"`
+	WetBulb           *float64 `json:"wet_bulb"`
+	HeatIndex         *float64 `json:"heat_index"`
+	WindChill         *float64 `json:"wind_chill"`
+	THWIndex          *float64 `json:"thw_index"`
+	THSWIndex         *float64 `json:"thsw_index"`
+
+	WindSpeedLast             *float64 `json:"wind_speed_last"`
+	WindDirLast               *int     `json:"wind_dir_last"`
+	WindSpeedAvgLast1Min      *float64 `json:"wind_speed_avg_last_1_min"`
+	WindDirScalarAvgLast1Min  *int     `json:"wind_dir_scalar_avg_last_1_min"`
+	WindSpeedAvgLast2Min      *float64 `json:"wind_speed_avg_last_2_min"`
+	WindDirScalarAvgLast2Min  *int     `json:"wind_dir_scalar_avg_last_2_min"`
+	WindSpeedHiLast2Min       *float64 `json:"wind_speed_hi_last_2_min"`
+	WindDirAtHiSpeedLast2Min  *int     `json:"wind_dir_at_hi_speed_last_2_min"`
+	WindSpeedAvgLast10Min     *float64 `json:"wind_speed_avg_last_10_min"`
+	WindDirScalarAvgLast10Min *int     `json:"wind_dir_scalar_avg_last_10_min"`
+	WindSpeedHiLast10Min      *float64 `json:"wind_speed_hi_last_10_min"`
+	WindDirAtHiSpeedLast10Min *int     `json:"wind_dir_at_hi_speed_last_10_min"`
+
+	RainSize            int    `json:"rain_size"`
+	RainRateLast        *int   `json:"rain_rate_last"`
+	RainRateHi          *int   `json:"rain_rate_hi"`
+	RainfallLast15Min   *int   `json:"rainfall_last_15_min"`
+	RainRateHiLast15Min *int   `json:"rain_rate_hi_last_15_min"`
+	RainfallLast60Min   *int   `json:"rainfall_last_60_min"`
+	RainfallLast24Hr    *int   `json:"rainfall_last_24_hr"`
+	RainStorm           *int   `json:"rain_storm"`
+	RainStormStartAt    *int64 `json:"rain_storm_start_at"`
+	RainfallDaily       *int   `json:"rainfall_daily"`
+	RainfallMonthly     *int   `json:"rainfall_monthly"`
+	RainfallYear        *int   `json:"rainfall_year"`
+
+	SolarRad         *float64 `json:"solar_rad"`
+	UVIndex          *float64 `json:"uv_index"`
+	RxState          int      `json:"rx_state"`
+	TransBatteryFlag int      `json:"trans_battery_flag"`
+}
+
+// BarometerConditions is the current_conditions record of the barometer
+// in a WeatherLink Live; rtldavis has none.
+type BarometerConditions struct {
+	LSID              int64    `json:"lsid"`
+	DataStructureType int      `json:"data_structure_type"`
+	BarSeaLevel       *float64 `json:"bar_sea_level"`
+	BarTrend          *float64 `json:"bar_trend"`
+	BarAbsolute       *float64 `json:"bar_absolute"`
+}
+
+// InsideConditions is the current_conditions record of the inside
+// sensor in a WeatherLink Live; rtldavis has none.
+type InsideConditions struct {
+	LSID              int64    `json:"lsid"`
+	DataStructureType int      `json:"data_structure_type"`
+	TempIn            *float64 `json:"temp_in"`
+	HumIn             *float64 `json:"hum_in"`
+	DewPointIn        *float64 `json:"dew_point_in"`
+	HeatIndexIn       *float64 `json:"heat_index_in"`
+}
+
+// Broadcast is the UDP real time packet of an ISS: wind and rain.
+type Broadcast struct {
+	DID        string               `json:"did"`
+	TS         int64                `json:"ts"`
+	Conditions []BroadcastCondition `json:"conditions"`
+}
+
+type BroadcastCondition struct {
+	LSID                      int64    `json:"lsid"`
+	DataStructureType         int      `json:"data_structure_type"`
+	TxID                      int      `json:"txid"`
+	WindSpeedLast             *float64 `json:"wind_speed_last"`
+	WindDirLast               *int     `json:"wind_dir_last"`
+	RainSize                  int      `json:"rain_size"`
+	RainRateLast              *int     `json:"rain_rate_last"`
+	Rain15Min                 *int     `json:"rain_15_min"`
+	Rain60Min                 *int     `json:"rain_60_min"`
+	Rain24Hr                  *int     `json:"rain_24_hr"`
+	RainStorm                 *int     `json:"rain_storm"`
+	RainStormStartAt          *int64   `json:"rain_storm_start_at"`
+	RainfallDaily             *int     `json:"rainfall_daily"`
+	RainfallMonthly           *int     `json:"rainfall_monthly"`
+	RainfallYear              *int     `json:"rainfall_year"`
+	WindSpeedHiLast10Min      *float64 `json:"wind_speed_hi_last_10_min"`
+	WindDirAtHiSpeedLast10Min *int     `json:"wind_dir_at_hi_speed_last_10_min"`
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func integer(v int) *int {
+	return &v
+}
+
+// clicks converts inches of rain to 0.01 in clicks.
+func clicks(inches float32) *int {
+	return integer(int(math.Round(float64(inches) / processor.RainPerClick)))
+}
+
+// lsid gives every record a stable logical sensor ID.
+func lsid(structureType, txid int) int64 {
+	return int64(structureType)<<8 | int64(txid)
+}
+
+// txid returns the transmitter channel of the ISS, one more than its ID.
+func txid(data processor.WeatherDatum) int {
+	if data.Wind != nil {
+		return int(data.Wind.Transmitter) + 1
+	}
+	return 1
+}
+
+// Conditions returns the current conditions of data.
+func Conditions(data processor.WeatherDatum) []any {
+	tx := txid(data)
+	iss := ISSConditions{
+		LSID:              lsid(typeISS, tx),
+		DataStructureType: typeISS,
+		TxID:              tx,
+		RainSize:          rainSize01in,
+	}
+	if d := data.Temperature; d != nil {
+		iss.Temp = float(float64(d.Value))
+	}
+	if d := data.Humidity; d != nil {
+		iss.Hum = float(float64(d.Value))
+	}
+	if d := data.DewPoint; d != nil {
+		iss.DewPoint = float(float64(d.Value))
+	}
+	if d := data.Wind; d != nil {
+		iss.WindSpeedLast = float(float64(d.Speed))
+		iss.WindDirLast = integer(int(d.Direction))
+	}
+	if d := data.PeakWind; d != nil {
+		iss.WindSpeedAvgLast10Min = float(float64(d.Average))
+		iss.WindSpeedHiLast10Min = float(float64(d.Speed))
+		iss.WindDirAtHiSpeedLast10Min = integer(int(d.Direction))
+	}
+	if d := data.RainRate; d != nil {
+		iss.RainRateLast = clicks(d.InchesPerHour)
+	}
+	if d := data.RainTotals; d != nil {
+		iss.RainfallLast60Min = clicks(d.LastHour)
+		iss.RainfallLast24Hr = clicks(d.Last24h)
+		iss.RainfallDaily = clicks(d.Daily)
+	}
+	if d := data.SolarRadiation; d != nil {
+		iss.SolarRad = float(float64(d.Value))
+	}
+	if d := data.UV; d != nil {
+		iss.UVIndex = float(float64(d.Value))
+	}
+	if d := data.Battery; d != nil && d.IsLow {
+		iss.TransBatteryFlag = 1
+	}
+	return []any{
+		iss,
+		BarometerConditions{LSID: lsid(typeBarometer, 0), DataStructureType: typeBarometer},
+		InsideConditions{LSID: lsid(typeInside, 0), DataStructureType: typeInside},
+	}
+}
+
+// NewBroadcast returns the real time packet of data.
+func NewBroadcast(did string, data processor.WeatherDatum, now time.Time) Broadcast {
+	iss := Conditions(data)[0].(ISSConditions)
+	return Broadcast{
+		DID: did,
+		TS:  now.Unix(),
+		Conditions: []BroadcastCondition{{
+			LSID:                      iss.LSID,
+			DataStructureType:         typeISS,
+			TxID:                      iss.TxID,
+			WindSpeedLast:             iss.WindSpeedLast,
+			WindDirLast:               iss.WindDirLast,
+			RainSize:                  iss.RainSize,
+			RainRateLast:              iss.RainRateLast,
+			Rain60Min:                 iss.RainfallLast60Min,
+			Rain24Hr:                  iss.RainfallLast24Hr,
+			RainfallDaily:             iss.RainfallDaily,
+			WindSpeedHiLast10Min:      iss.WindSpeedHiLast10Min,
+			WindDirAtHiSpeedLast10Min: iss.WindDirAtHiSpeedLast10Min,
+		}},
+	}
+}
+
+// Server answers the local API and sends the real time broadcasts.
+type Server struct {
+	// Latest returns the data to answer with.
+	Latest func() processor.WeatherDatum
+	// DID is the device ID, twelve hex digits.
+	DID string
+	// BroadcastAddr is where real time packets go, 255.255.255.255:22222
+	// on a WeatherLink Live.
+	BroadcastAddr string
+	// Interval is the time between real time packets.
+	Interval time.Duration
+
+	mutex sync.Mutex
+	until time.Time // end of the real time broadcasts
+	once  sync.Once // starts the broadcaster
+	wake  chan struct{}
+	done  chan struct{}
+	stop  sync.Once // closes done
+	wg    sync.WaitGroup
+}
+
+func NewServer(latest func() processor.WeatherDatum, did, broadcastAddr string) *Server {
+	return &Server{
+		Latest:        latest,
+		DID:           did,
+		BroadcastAddr: broadcastAddr,
+		Interval:      2500 * time.Millisecond,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// Close stops the broadcasts.  Calling it again does nothing.
+func (s *Server) Close() error {
+	s.stop.Do(func() { close(s.done) })
+	s.wg.Wait()
+	return nil
+}
+
+type response struct {
+	Data  any     `json:"data"`
+	Error *string `json:"error"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/current_conditions":
+		s.reply(w, http.StatusOK, map[string]any{
+			"did":        s.DID,
+			"ts":         time.Now().Unix(),
+			"conditions": Conditions(s.Latest()),
+		}, "")
+	case "/v1/real_time":
+		duration, err := strconv.Atoi(r.URL.Query().Get("duration"))
+		if err != nil || duration < 1 {
+			s.reply(w, http.StatusBadRequest, nil, "duration must be a positive number of seconds")
+			return
+		}
+		_, port, _ := net.SplitHostPort(s.BroadcastAddr)
+		broadcastPort, _ := strconv.Atoi(port)
+		s.start(time.Duration(duration) * time.Second)
+		s.reply(w, http.StatusOK, map[string]any{
+			"broadcast_port": broadcastPort,
+			"duration":       duration,
+		}, "")
+	default:
+		s.reply(w, http.StatusNotFound, nil, "unknown path "+r.URL.Path)
+	}
+}
+
+func (s *Server) reply(w http.ResponseWriter, status int, data any, message string) {
+	resp := response{Data: data}
+	if message != "" {
+		resp.Error = &message
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// start broadcasts for the duration from now, extending broadcasts under
+// way.
+func (s *Server) start(duration time.Duration) {
+	s.mutex.Lock()
+	if until := time.Now().Add(duration); until.After(s.until) {
+		s.until = until
+	}
+	s.mutex.Unlock()
+	s.once.Do(func() {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.broadcast()
+		}()
+	})
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) broadcasting() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return time.Now().Before(s.until)
+}
+
+func (s *Server) broadcast() {
+	var conn net.PacketConn
+	var addr *net.UDPAddr
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+		if !s.broadcasting() {
+			continue
+		}
+		if conn == nil {
+			var err error
+			if addr, err = net.ResolveUDPAddr("udp4", s.BroadcastAddr); err == nil {
+				// Go allows broadcasts on UDP sockets.
+				conn, err = net.ListenPacket("udp4", ":0")
+			}
+			if err != nil {
+				slog.Error("Could not start WeatherLink Live broadcasts", "error", err)
+				continue
+			}
+		}
+		b, err := json.Marshal(NewBroadcast(s.DID, s.Latest(), time.Now()))
+		if err == nil {
+			_, err = conn.WriteTo(b, addr)
+		}
+		if err != nil {
+			slog.Error("Error sending WeatherLink Live broadcast", "error", err)
+		}
+	}
+}
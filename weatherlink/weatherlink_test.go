@@ -0,0 +1,139 @@
+package weatherlink
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nathanmsmith/rtldavis/processor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var data = processor.WeatherDatum{
+	Temperature: &processor.TemperatureDatum{Value: 62.5},
+	Humidity:    &processor.HumidityDatum{Value: 71},
+	DewPoint:    &processor.DewPointDatum{Value: 53.1},
+	Wind:        &processor.WindDatum{Speed: 6, Direction: 245, Transmitter: 0},
+	PeakWind:    &processor.PeakWindDatum{Speed: 14, Direction: 250, Average: 5.5},
+	RainRate:    &processor.RainRateDatum{InchesPerHour: 0.12},
+	RainTotals:  &processor.RainTotalsDatum{Daily: 0.3, LastHour: 0.05, Last24h: 0.41},
+	UV:          &processor.UVDatum{Value: 2.5},
+
+	SolarRadiation: &processor.SolarRadiationDatum{Value: 340},
+}
+
+func get(t *testing.T, s *Server, url string) (int, map[string]any) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func TestCurrentConditions(t *testing.T) {
+	s := NewServer(func() processor.WeatherDatum { return data }, "001D0A700002", "127.0.0.1:22222")
+	defer func() { _ = s.Close() }()
+
+	status, body := get(t, s, "/v1/current_conditions")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, body["error"])
+	d := body["data"].(map[string]any)
+	assert.Equal(t, "001D0A700002", d["did"])
+	assert.InDelta(t, time.Now().Unix(), d["ts"], 5)
+
+	conditions := d["conditions"].([]any)
+	require.Len(t, conditions, 3)
+	iss := conditions[0].(map[string]any)
+	for field, want := range map[string]any{
+		"data_structure_type":              1.0,
+		"txid":                             1.0,
+		"temp":                             62.5,
+		"hum":                              71.0,
+		"dew_point":                        53.099998474121094,
+		"heat_index":                       nil,
+		"wind_speed_last":                  6.0,
+		"wind_dir_last":                    245.0,
+		"wind_speed_avg_last_1_min":        nil,
+		"wind_speed_avg_last_10_min":       5.5,
+		"wind_speed_hi_last_10_min":        14.0,
+		"wind_dir_at_hi_speed_last_10_min": 250.0,
+		"rain_size":                        1.0,
+		"rain_rate_last":                   12.0,
+		"rainfall_last_60_min":             5.0,
+		"rainfall_last_24_hr":              41.0,
+		"rainfall_daily":                   30.0,
+		"rainfall_monthly":                 nil,
+		"solar_rad":                        340.0,
+		"uv_index":                         2.5,
+		"trans_battery_flag":               0.0,
+	} {
+		assert.Equal(t, want, iss[field], field)
+	}
+	assert.Equal(t, 3.0, conditions[1].(map[string]any)["data_structure_type"])
+	assert.Nil(t, conditions[1].(map[string]any)["bar_sea_level"])
+	assert.Equal(t, 4.0, conditions[2].(map[string]any)["data_structure_type"])
+}
+
+func TestRealTime(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	s := NewServer(func() processor.WeatherDatum { return data }, "001D0A700002", conn.LocalAddr().String())
+	s.Interval = 10 * time.Millisecond
+	defer func() { _ = s.Close() }()
+
+	status, body := get(t, s, "/v1/real_time?duration=1")
+	assert.Equal(t, http.StatusOK, status)
+	d := body["data"].(map[string]any)
+	assert.Equal(t, float64(conn.LocalAddr().(*net.UDPAddr).Port), d["broadcast_port"])
+	assert.Equal(t, 1.0, d["duration"])
+
+	buf := make([]byte, 2048)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var b Broadcast
+	require.NoError(t, json.Unmarshal(buf[:n], &b))
+	assert.Equal(t, "001D0A700002", b.DID)
+	require.Len(t, b.Conditions, 1)
+	c := b.Conditions[0]
+	assert.Equal(t, 1, c.TxID)
+	assert.Equal(t, 6.0, *c.WindSpeedLast)
+	assert.Equal(t, 245, *c.WindDirLast)
+	assert.Equal(t, 5, *c.Rain60Min)
+	assert.Equal(t, 30, *c.RainfallDaily)
+	assert.Equal(t, 14.0, *c.WindSpeedHiLast10Min)
+	assert.Nil(t, c.RainStorm)
+
+	// The broadcasts stop when the duration is over.
+	time.Sleep(1100 * time.Millisecond)
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			break
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := NewServer(func() processor.WeatherDatum { return data }, "001D0A700002", "127.0.0.1:22222")
+	defer func() { _ = s.Close() }()
+
+	status, body := get(t, s, "/v1/real_time?duration=x")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.NotEmpty(t, body["error"])
+	status, _ = get(t, s, "/v1/nothing")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestCloseTwice(t *testing.T) {
+	s := NewServer(func() processor.WeatherDatum { return data }, "001D0A700002", "127.0.0.1:22222")
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close())
+}